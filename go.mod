@@ -1,5 +1,5 @@
 module github.com/brody192/ext
 
-go 1.22.3
+go 1.23.0
 
 require github.com/go-chi/chi/v5 v5.0.12
@@ -4,7 +4,6 @@ package middleware
 
 import (
 	"context"
-	"errors"
 	"io"
 	"net/http"
 	"sync"
@@ -22,6 +21,9 @@ type limitedReader struct {
 // BodyLimit middleware sets the maximum allowed size for a request body, if the size exceeds the configured limit, it
 // sends "413 - Request Entity Too Large" response. The BodyLimit is determined based on both `Content-Length` request
 // header and actual content read, which makes it super secure.
+//
+// the Content-Length check rejects through the ErrorHandler on the request context, reads past the limit
+// return ErrBodyTooLarge so handlers can respond with http.StatusRequestEntityTooLarge themselves
 func LimitBytes(limitBytes int64) func(http.Handler) http.Handler {
 	var pool = sync.Pool{New: func() any {
 		return &limitedReader{limitBytes: limitBytes}
@@ -31,7 +33,7 @@ func LimitBytes(limitBytes int64) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 			if r.ContentLength > limitBytes {
-				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				reject(w, r, nil, ErrBodyTooLarge, http.StatusRequestEntityTooLarge)
 				return
 			}
 
@@ -50,7 +52,7 @@ func (r *limitedReader) Read(b []byte) (n int, err error) {
 	n, err = r.reader.Read(b)
 	r.read += int64(n)
 	if r.read > r.limitBytes {
-		return n, errors.New(http.StatusText(http.StatusRequestEntityTooLarge))
+		return n, ErrBodyTooLarge
 	}
 	return
 }
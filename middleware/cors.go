@@ -1,31 +1,212 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/brody192/ext/variables"
 )
 
+type CorsConfig struct {
+	// exact origins such as https://example.com, wildcard subdomains such as https://*.example.com,
+	// or a single "*" to allow any origin
+	AllowOrigins []string
+	// regular expressions matched against the full origin, compiled once, panics if one does not compile
+	AllowOriginPatterns []string
+	// called for origins not matched by AllowOrigins or AllowOriginPatterns
+	AllowOriginFunc func(r *http.Request, origin string) bool
+
+	// methods sent in preflight responses, defaults to variables.Methods
+	AllowMethods []string
+	// headers sent in preflight responses, when empty the requested headers are reflected back
+	AllowHeaders []string
+	// headers the browser is allowed to read from actual responses
+	ExposeHeaders []string
+
+	// seconds a preflight response may be cached for, 0 omits the header, negative values send 0 to disable caching
+	MaxAge int
+	// sends Access-Control-Allow-Credentials, the request origin is always reflected instead of "*" when set
+	//
+	// combined with "*" any site can make cookie authenticated requests and read the responses,
+	// only allow origins you trust
+	AllowCredentials bool
+}
+
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+type corsPolicy struct {
+	allowAny      bool
+	origins       map[string]struct{}
+	wildcards     []wildcardOrigin
+	patterns      []*regexp.Regexp
+	originFunc    func(r *http.Request, origin string) bool
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+	credentials   bool
+}
+
+var corsAny = Cors(CorsConfig{
+	AllowOrigins: []string{variables.HeaderWildcard},
+})
+
 // sets all cors headers to accept anything
+//
+// sends a wildcard origin without credentials, so browsers don't send cookies or read credentialed responses,
+// use Cors with AllowCredentials and the trusted origins for that
 func CorsAny(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set(variables.HeaderAccessControlAllowCredentials, variables.HeaderTrue)
-		w.Header().Set(variables.HeaderAccessControlAllowOrigin, "*")
-		w.Header().Set(variables.HeaderAccessControlAllowMethods,
-			fmt.Sprintf(
-				"%s, %s, %s, %s, %s, %s, %s, %s, %s",
-				http.MethodGet,
-				http.MethodPost,
-				http.MethodPut,
-				http.MethodConnect,
-				http.MethodDelete,
-				http.MethodHead,
-				http.MethodPatch,
-				http.MethodOptions,
-				http.MethodTrace,
-			))
-		w.Header().Set(variables.HeaderAccessControlAllowHeaders, variables.HeaderWildcard)
-		next.ServeHTTP(w, r)
-	})
+	return corsAny(next)
+}
+
+// cors middleware that only allows the configured origins
+//
+// preflight requests are answered with http.StatusNoContent and never reach the next handler
+func Cors(c CorsConfig) func(http.Handler) http.Handler {
+	var p = newCorsPolicy(c)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var preflight = r.Method == http.MethodOptions && r.Header.Get(variables.HeaderAccessControlRequestMethod) != ""
+
+			w.Header().Add(variables.HeaderVary, variables.HeaderOrigin)
+
+			if preflight {
+				w.Header().Add(variables.HeaderVary, variables.HeaderAccessControlRequestMethod)
+				w.Header().Add(variables.HeaderVary, variables.HeaderAccessControlRequestHeaders)
+			}
+
+			var origin = r.Header.Get(variables.HeaderOrigin)
+
+			if origin == "" || !p.isAllowed(r, origin) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if p.allowAny && !p.credentials {
+				w.Header().Set(variables.HeaderAccessControlAllowOrigin, variables.HeaderWildcard)
+			} else {
+				w.Header().Set(variables.HeaderAccessControlAllowOrigin, origin)
+			}
+
+			if p.credentials {
+				w.Header().Set(variables.HeaderAccessControlAllowCredentials, variables.HeaderTrue)
+			}
+
+			if !preflight {
+				if p.exposeHeaders != "" {
+					w.Header().Set(variables.HeaderAccessControlExposeHeaders, p.exposeHeaders)
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set(variables.HeaderAccessControlAllowMethods, p.allowMethods)
+
+			if p.allowHeaders != "" {
+				w.Header().Set(variables.HeaderAccessControlAllowHeaders, p.allowHeaders)
+			} else if requested := r.Header.Get(variables.HeaderAccessControlRequestHeaders); requested != "" {
+				w.Header().Set(variables.HeaderAccessControlAllowHeaders, requested)
+			}
+
+			if p.maxAge != "" {
+				w.Header().Set(variables.HeaderAccessControlMaxAge, p.maxAge)
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func newCorsPolicy(c CorsConfig) *corsPolicy {
+	var p = &corsPolicy{
+		origins:     make(map[string]struct{}, len(c.AllowOrigins)),
+		originFunc:  c.AllowOriginFunc,
+		credentials: c.AllowCredentials,
+	}
+
+	for _, origin := range c.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+
+		switch {
+		case origin == variables.HeaderWildcard:
+			p.allowAny = true
+		case strings.Contains(origin, variables.HeaderWildcard):
+			var prefix, suffix, _ = strings.Cut(origin, variables.HeaderWildcard)
+			p.wildcards = append(p.wildcards, wildcardOrigin{prefix: prefix, suffix: suffix})
+		case origin != "":
+			p.origins[origin] = struct{}{}
+		}
+	}
+
+	for _, pattern := range c.AllowOriginPatterns {
+		p.patterns = append(p.patterns, regexp.MustCompile(pattern))
+	}
+
+	var methods = c.AllowMethods
+	if len(methods) == 0 {
+		methods = variables.Methods
+	}
+
+	p.allowMethods = strings.Join(methods, ", ")
+
+	// a literal wildcard is treated as a plain header name by browsers when credentials are included
+	if !(c.AllowCredentials && len(c.AllowHeaders) == 1 && c.AllowHeaders[0] == variables.HeaderWildcard) {
+		p.allowHeaders = strings.Join(c.AllowHeaders, ", ")
+	}
+
+	p.exposeHeaders = strings.Join(c.ExposeHeaders, ", ")
+
+	switch {
+	case c.MaxAge > 0:
+		p.maxAge = strconv.Itoa(c.MaxAge)
+	case c.MaxAge < 0:
+		p.maxAge = "0"
+	}
+
+	return p
+}
+
+func (p *corsPolicy) isAllowed(r *http.Request, origin string) bool {
+	if p.allowAny {
+		return true
+	}
+
+	var lowerOrigin = strings.ToLower(origin)
+
+	if _, ok := p.origins[lowerOrigin]; ok {
+		return true
+	}
+
+	for _, wc := range p.wildcards {
+		if len(lowerOrigin) > len(wc.prefix)+len(wc.suffix) &&
+			strings.HasPrefix(lowerOrigin, wc.prefix) &&
+			strings.HasSuffix(lowerOrigin, wc.suffix) &&
+			!strings.ContainsAny(lowerOrigin[len(wc.prefix):len(lowerOrigin)-len(wc.suffix)], "/:") {
+			return true
+		}
+	}
+
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+
+	if p.originFunc != nil {
+		return p.originFunc(r, origin)
+	}
+
+	return false
 }
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestCorsAnyWithoutCredentials(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(variables.HeaderOrigin, "https://evil.example")
+
+	var w = httptest.NewRecorder()
+	CorsAny(http.NotFoundHandler()).ServeHTTP(w, r)
+
+	if got := w.Header().Get(variables.HeaderAccessControlAllowOrigin); got != variables.HeaderWildcard {
+		t.Errorf("allow origin = %q, want %q", got, variables.HeaderWildcard)
+	}
+
+	if got := w.Header().Get(variables.HeaderAccessControlAllowCredentials); got != "" {
+		t.Errorf("allow credentials = %q, want none", got)
+	}
+}
+
+func TestCorsCredentialsReflectOrigin(t *testing.T) {
+	var h = Cors(CorsConfig{
+		AllowOrigins:     []string{"https://app.example"},
+		AllowCredentials: true,
+	})(http.NotFoundHandler())
+
+	var tests = []struct {
+		origin     string
+		wantOrigin string
+	}{
+		{"https://app.example", "https://app.example"},
+		{"https://evil.example", ""},
+	}
+
+	for _, tt := range tests {
+		var r = httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(variables.HeaderOrigin, tt.origin)
+
+		var w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if got := w.Header().Get(variables.HeaderAccessControlAllowOrigin); got != tt.wantOrigin {
+			t.Errorf("%s: allow origin = %q, want %q", tt.origin, got, tt.wantOrigin)
+		}
+	}
+}
@@ -1,19 +1,20 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strings"
 )
 
 // disallow a fragment specified in list from appearing in path
 //
-// returns with the status code specified by code
+// rejects with the status code specified by code through the ErrorHandler on the request context
 func DisallowPaths(list []string, code int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			for _, txt := range list {
 				if strings.Contains(r.URL.Path, txt) {
-					http.Error(w, http.StatusText(code), code)
+					reject(w, r, nil, fmt.Errorf("%w: %s", ErrPathDisallowed, txt), code)
 					return
 				}
 			}
@@ -24,13 +25,13 @@ func DisallowPaths(list []string, code int) func(http.Handler) http.Handler {
 
 // disallow a requests with headers specified in headers
 //
-// returns with the status code specified by code
+// rejects with the status code specified by code through the ErrorHandler on the request context
 func DisallowHeaders(headers []string, code int) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			for _, h := range headers {
 				if r.Header.Get(h) != "" {
-					http.Error(w, http.StatusText(code), code)
+					reject(w, r, nil, fmt.Errorf("%w: %s", ErrHeaderDisallowed, h), code)
 					return
 				}
 			}
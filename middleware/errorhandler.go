@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/brody192/ext/respond"
+)
+
+// errors passed to the ErrorHandler, identifying which middleware rejected the request
+var (
+	ErrPathDisallowed    = errors.New("path disallowed")
+	ErrHeaderDisallowed  = errors.New("header disallowed")
+	ErrBodyTooLarge      = errors.New(http.StatusText(http.StatusRequestEntityTooLarge))
+	ErrInvalidRemoteAddr = errors.New("invalid remote address")
+)
+
+var errorHandlerCtxKey = &contextKey{"ErrorHandler"}
+
+// writes the response for a request rejected by a middleware in this package
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error, code int)
+
+// used when neither the middleware's config nor the request context carries an ErrorHandler
+//
+// renders problem details when UseProblemDetails is set and plain text otherwise
+var DefaultErrorHandler ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error, code int) {
+	if UseProblemDetails {
+		ProblemErrorHandler(w, r, err, code)
+		return
+	}
+
+	TextErrorHandler(w, r, err, code)
+}
+
+// writes the status text as plain text with respond.Error, which includes the request id when set
+func TextErrorHandler(w http.ResponseWriter, r *http.Request, _ error, code int) {
+	respond.Error(w, r, http.StatusText(code), code)
+}
+
+// writes the error as RFC 9457 problem details with respond.ErrorProblem
+func ProblemErrorHandler(w http.ResponseWriter, r *http.Request, err error, code int) {
+	respond.ErrorProblem(w, r, err, code)
+}
+
+// stores h on the request context, used by every middleware in this package that comes after it
+func WithErrorHandler(h ErrorHandler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), errorHandlerCtxKey, h)))
+		})
+	}
+}
+
+// returns the ErrorHandler stored by WithErrorHandler, DefaultErrorHandler if there is none
+func GetErrorHandler(ctx context.Context) ErrorHandler {
+	if h, ok := ctx.Value(errorHandlerCtxKey).(ErrorHandler); ok && h != nil {
+		return h
+	}
+
+	return DefaultErrorHandler
+}
+
+// rejects the request with h, falling back to the handler on the context
+func reject(w http.ResponseWriter, r *http.Request, h ErrorHandler, err error, code int) {
+	if h == nil {
+		h = GetErrorHandler(r.Context())
+	}
+
+	h(w, r, err, code)
+}
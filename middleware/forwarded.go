@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/brody192/ext/variables"
+)
+
+// ForwardedHeaders can be used as the header list for TrustIPHeaders, TrustSchemeHeaders
+// or TrustForwardedHosts to source those values from the RFC 7239 Forwarded header
+var ForwardedHeaders = []string{
+	variables.HeaderForwarded,
+}
+
+// a single element of a RFC 7239 Forwarded header, one is added by every proxy
+type forwardedElement struct {
+	For   string
+	By    string
+	Proto string
+	Host  string
+}
+
+// parses every Forwarded header value into its elements, ordered from the client to the nearest proxy
+//
+// malformed pairs are skipped, parameter names are case-insensitive and quoted values are unescaped
+func parseForwarded(values []string) []forwardedElement {
+	var elements []forwardedElement
+
+	for _, value := range values {
+		var element forwardedElement
+		var hasPairs bool
+
+		for len(value) > 0 {
+			var key, val, rest, sep = nextForwardedPair(value)
+			value = rest
+
+			if key != "" {
+				hasPairs = true
+
+				switch strings.ToLower(key) {
+				case "for":
+					element.For = val
+				case "by":
+					element.By = val
+				case "proto":
+					element.Proto = strings.ToLower(val)
+				case "host":
+					element.Host = val
+				}
+			}
+
+			if sep == ',' || len(value) == 0 {
+				if hasPairs {
+					elements = append(elements, element)
+				}
+
+				element = forwardedElement{}
+				hasPairs = false
+			}
+		}
+	}
+
+	return elements
+}
+
+// reads one key=value pair from s, returning the remaining string and the separator that ended the pair
+func nextForwardedPair(s string) (key, value, rest string, sep byte) {
+	var i int
+
+	for i < len(s) && s[i] != '=' && s[i] != ';' && s[i] != ',' {
+		i++
+	}
+
+	key = strings.TrimSpace(s[:i])
+
+	if i == len(s) || s[i] != '=' {
+		// a parameter without a value is malformed, drop it
+		if i < len(s) {
+			return "", "", s[i+1:], s[i]
+		}
+
+		return "", "", "", 0
+	}
+
+	i++
+
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+
+	if i < len(s) && s[i] == '"' {
+		var b strings.Builder
+
+		i++
+
+		for i < len(s) && s[i] != '"' {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+
+			b.WriteByte(s[i])
+			i++
+		}
+
+		// skip the closing quote
+		if i < len(s) {
+			i++
+		}
+
+		value = b.String()
+	} else {
+		var start = i
+
+		for i < len(s) && s[i] != ';' && s[i] != ',' {
+			i++
+		}
+
+		value = strings.TrimSpace(s[start:i])
+	}
+
+	for i < len(s) && s[i] != ';' && s[i] != ',' {
+		i++
+	}
+
+	if i == len(s) {
+		return key, value, "", 0
+	}
+
+	return key, value, s[i+1:], s[i]
+}
+
+// splits a Forwarded node such as `192.0.2.43:47011` or `[2001:db8::1]:4711` into its address and port
+//
+// returns an empty address for the "unknown" identifier and obfuscated identifiers such as `_hidden`
+func splitForwardedNode(node string) (addr, port string) {
+	if node == "" || strings.EqualFold(node, "unknown") || node[0] == '_' {
+		return "", ""
+	}
+
+	if host, p, err := net.SplitHostPort(node); err == nil {
+		if p != "" && p[0] == '_' {
+			p = ""
+		}
+
+		return host, p
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(node, "["), "]"), ""
+}
+
+// get the scheme from the nearest element of the Forwarded header that includes one
+func forwardedProto(headers http.Header) string {
+	var elements = parseForwarded(headers.Values(variables.HeaderForwarded))
+
+	for i := len(elements) - 1; i >= 0; i-- {
+		if elements[i].Proto != "" {
+			return elements[i].Proto
+		}
+	}
+
+	return ""
+}
+
+// get the host from the nearest element of the Forwarded header that includes one
+func forwardedHost(headers http.Header) string {
+	var elements = parseForwarded(headers.Values(variables.HeaderForwarded))
+
+	for i := len(elements) - 1; i >= 0; i-- {
+		if elements[i].Host != "" {
+			return elements[i].Host
+		}
+	}
+
+	return ""
+}
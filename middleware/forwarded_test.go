@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestParseForwarded(t *testing.T) {
+	var tests = []struct {
+		name   string
+		values []string
+		want   []forwardedElement
+	}{
+		{
+			"single element",
+			[]string{"for=192.0.2.60;proto=http;by=203.0.113.43;host=example.com"},
+			[]forwardedElement{{For: "192.0.2.60", By: "203.0.113.43", Proto: "http", Host: "example.com"}},
+		},
+		{
+			"quoted ipv6 with port",
+			[]string{`for="[2001:db8:cafe::17]:4711"`},
+			[]forwardedElement{{For: "[2001:db8:cafe::17]:4711"}},
+		},
+		{
+			"unknown and obfuscated",
+			[]string{"for=unknown, for=_hidden;by=_proxy1"},
+			[]forwardedElement{{For: "unknown"}, {For: "_hidden", By: "_proxy1"}},
+		},
+		{
+			"several elements",
+			[]string{"for=192.0.2.43, for=198.51.100.17;proto=https"},
+			[]forwardedElement{{For: "192.0.2.43"}, {For: "198.51.100.17", Proto: "https"}},
+		},
+		{
+			"several header lines",
+			[]string{"for=192.0.2.43", "for=198.51.100.17, for=203.0.113.5"},
+			[]forwardedElement{{For: "192.0.2.43"}, {For: "198.51.100.17"}, {For: "203.0.113.5"}},
+		},
+		{
+			"comma and semicolon inside quotes",
+			[]string{`for="_a,b;c";host="example.com", for=192.0.2.1`},
+			[]forwardedElement{{For: "_a,b;c", Host: "example.com"}, {For: "192.0.2.1"}},
+		},
+		{
+			"escaped quote",
+			[]string{`for="_a\"b";proto=https`},
+			[]forwardedElement{{For: `_a"b`, Proto: "https"}},
+		},
+		{
+			"mixed case names",
+			[]string{"For=192.0.2.1;PROTO=HTTPS;Host=Example.com;bY=10.0.0.1"},
+			[]forwardedElement{{For: "192.0.2.1", By: "10.0.0.1", Proto: "https", Host: "Example.com"}},
+		},
+		{
+			"whitespace around pairs",
+			[]string{" for = 192.0.2.1 ; proto=https ,  for=192.0.2.2 "},
+			[]forwardedElement{{For: "192.0.2.1", Proto: "https"}, {For: "192.0.2.2"}},
+		},
+		{
+			"pair without value is skipped",
+			[]string{"for;proto=https"},
+			[]forwardedElement{{Proto: "https"}},
+		},
+		{
+			"element of only malformed pairs is dropped",
+			[]string{"garbage, for=192.0.2.1"},
+			[]forwardedElement{{For: "192.0.2.1"}},
+		},
+		{
+			"unterminated quote",
+			[]string{`for="192.0.2.1`},
+			[]forwardedElement{{For: "192.0.2.1"}},
+		},
+		{
+			"unknown parameters are ignored",
+			[]string{"for=192.0.2.1;secret=x;proto=https"},
+			[]forwardedElement{{For: "192.0.2.1", Proto: "https"}},
+		},
+		{
+			"empty elements",
+			[]string{",,for=192.0.2.1,,", ""},
+			[]forwardedElement{{For: "192.0.2.1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseForwarded(tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitForwardedNode(t *testing.T) {
+	var tests = []struct {
+		node, addr, port string
+	}{
+		{"192.0.2.43", "192.0.2.43", ""},
+		{"192.0.2.43:47011", "192.0.2.43", "47011"},
+		{"[2001:db8:cafe::17]:4711", "2001:db8:cafe::17", "4711"},
+		{"[2001:db8:cafe::17]", "2001:db8:cafe::17", ""},
+		{"192.0.2.43:_port", "192.0.2.43", ""},
+		{"unknown", "", ""},
+		{"UNKNOWN", "", ""},
+		{"_hidden", "", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		if addr, port := splitForwardedNode(tt.node); addr != tt.addr || port != tt.port {
+			t.Errorf("splitForwardedNode(%q) = %q, %q, want %q, %q", tt.node, addr, port, tt.addr, tt.port)
+		}
+	}
+}
+
+func TestForwardedProtoAndHost(t *testing.T) {
+	var h = http.Header{}
+	h.Add(variables.HeaderForwarded, "for=192.0.2.1;proto=http;host=a.example")
+	h.Add(variables.HeaderForwarded, "for=10.0.0.1;proto=https, for=10.0.0.2")
+
+	// the nearest element that has the parameter wins
+	if got := forwardedProto(h); got != "https" {
+		t.Errorf("proto = %q, want https", got)
+	}
+
+	if got := forwardedHost(h); got != "a.example" {
+		t.Errorf("host = %q, want a.example", got)
+	}
+}
@@ -1,14 +1,16 @@
 package middleware
 
-import (
-	"strings"
-)
+// render rejections from DisallowPaths, DisallowHeaders, LimitBytes and TrustProxy
+// as RFC 9457 problem details with respond.WriteProblem instead of plain text
+//
+// only used by DefaultErrorHandler
+var UseProblemDetails = false
 
-func sanitizeURI(uri string) string {
-	// double slash `\\`, `//` or even `\/` is absolute uri for browsers and by redirecting request to that uri
-	// we are vulnerable to open redirect attack. so replace all slashes from the beginning with single slash
-	if len(uri) > 1 && (uri[0] == '\\' || uri[0] == '/') && (uri[1] == '\\' || uri[1] == '/') {
-		uri = "/" + strings.TrimLeft(uri, `/\`)
-	}
-	return uri
+// key for values stored on the request context, the pointer keeps keys unique across packages
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string {
+	return "ext/middleware context value " + k.name
 }
@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// renders a LogEntry as a single line into buf, without the trailing newline
+type LogFormatter interface {
+	Format(buf *bytes.Buffer, e *LogEntry)
+}
+
+// a LogFormatter that also writes a header once before the first line, such as W3C directives
+type LogHeaderFormatter interface {
+	LogFormatter
+	Header() string
+}
+
+// adapts a function to the LogFormatter interface
+type LogFormatterFunc func(buf *bytes.Buffer, e *LogEntry)
+
+func (f LogFormatterFunc) Format(buf *bytes.Buffer, e *LogEntry) {
+	f(buf, e)
+}
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// Apache Common Log Format
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+var CommonLogFormat LogFormatter = LogFormatterFunc(formatCommon)
+
+// Apache Combined Log Format, the Common Log Format followed by the referer and user agent
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://example.com/" "Mozilla/5.0"
+var CombinedLogFormat LogFormatter = LogFormatterFunc(formatCombined)
+
+func formatCommon(buf *bytes.Buffer, e *LogEntry) {
+	buf.WriteString(clfField(hostOnly(e.IP)))
+	buf.WriteString(" - ")
+	buf.WriteString(clfField(e.User))
+	buf.WriteString(" [")
+	buf.WriteString(e.Time.Format(clfTimeLayout))
+	buf.WriteString("] \"")
+	buf.WriteString(clfEscape(e.Method))
+	buf.WriteByte(' ')
+	buf.WriteString(clfEscape(e.URI))
+	buf.WriteByte(' ')
+	buf.WriteString(clfEscape(e.Proto))
+	buf.WriteString("\" ")
+	buf.WriteString(strconv.Itoa(e.Status))
+	buf.WriteByte(' ')
+
+	if e.Bytes > 0 {
+		buf.WriteString(strconv.Itoa(e.Bytes))
+	} else {
+		buf.WriteByte('-')
+	}
+}
+
+func formatCombined(buf *bytes.Buffer, e *LogEntry) {
+	formatCommon(buf, e)
+	buf.WriteString(" \"")
+	buf.WriteString(clfQuoted(e.Referer))
+	buf.WriteString("\" \"")
+	buf.WriteString(clfQuoted(e.UserAgent))
+	buf.WriteByte('"')
+}
+
+// "-" for empty values, spaces and control characters are escaped
+func clfField(v string) string {
+	if v == "" {
+		return "-"
+	}
+
+	return strings.ReplaceAll(clfEscape(v), " ", `\x20`)
+}
+
+// "-" for empty values, otherwise escaped for use inside quotes
+func clfQuoted(v string) string {
+	if v == "" {
+		return "-"
+	}
+
+	return clfEscape(v)
+}
+
+// escapes quotes, backslashes and control characters the same way Apache does
+func clfEscape(v string) string {
+	var i = strings.IndexFunc(v, func(r rune) bool {
+		return r == '"' || r == '\\' || r < 0x20 || r == 0x7f
+	})
+
+	if i == -1 {
+		return v
+	}
+
+	var b strings.Builder
+	b.WriteString(v[:i])
+
+	for j := i; j < len(v); j++ {
+		switch c := v[j]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			b.WriteString(`\x`)
+			b.WriteString(strconv.FormatUint(uint64(c)>>4, 16))
+			b.WriteString(strconv.FormatUint(uint64(c)&0xf, 16))
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// strips the port from an address, the value is returned as is if it has none
+func hostOnly(addr string) string {
+	var host, _ = splitHostPort(addr)
+	return host
+}
+
+// the fields written by W3CLogFormat when none are given
+var W3CDefaultFields = []string{
+	"date",
+	"time",
+	"c-ip",
+	"cs-username",
+	"cs-method",
+	"cs-uri-stem",
+	"cs-uri-query",
+	"sc-status",
+	"sc-bytes",
+	"time-taken",
+	"cs(User-Agent)",
+	"cs(Referer)",
+}
+
+type w3cFormat struct {
+	fields []string
+}
+
+// W3C extended log file format with the given fields, defaults to W3CDefaultFields
+//
+// supported fields are date, time, c-ip, cs-username, cs-method, cs-uri, cs-uri-stem, cs-uri-query, cs-host,
+// cs-version, sc-status, sc-bytes, cs-bytes, time-taken, x-request-id, x-trace-id, x-span-id, x-route, cs(User-Agent) and cs(Referer),
+// unknown fields are written as "-"
+func W3CLogFormat(fields ...string) LogHeaderFormatter {
+	if len(fields) == 0 {
+		fields = W3CDefaultFields
+	}
+
+	return &w3cFormat{fields: fields}
+}
+
+func (f *w3cFormat) Header() string {
+	return "#Version: 1.0\n#Date: " + time.Now().UTC().Format(time.DateTime) + "\n#Fields: " + strings.Join(f.fields, " ") + "\n"
+}
+
+func (f *w3cFormat) Format(buf *bytes.Buffer, e *LogEntry) {
+	var utc = e.Time.UTC()
+	var stem, query, _ = strings.Cut(e.URI, "?")
+
+	for i, field := range f.fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+
+		var v string
+
+		switch strings.ToLower(field) {
+		case "date":
+			v = utc.Format(time.DateOnly)
+		case "time":
+			v = utc.Format(time.TimeOnly)
+		case "c-ip":
+			v = hostOnly(e.IP)
+		case "cs-username":
+			v = e.User
+		case "cs-method":
+			v = e.Method
+		case "cs-uri":
+			v = e.URI
+		case "cs-uri-stem":
+			v = stem
+		case "cs-uri-query":
+			v = query
+		case "cs-host":
+			v = e.Host
+		case "cs-version":
+			v = e.Proto
+		case "sc-status":
+			v = strconv.Itoa(e.Status)
+		case "sc-bytes":
+			v = strconv.Itoa(e.Bytes)
+		case "cs-bytes":
+			v = strconv.FormatInt(e.RequestBytes, 10)
+		case "time-taken":
+			v = strconv.FormatFloat(e.Duration.Seconds(), 'f', 3, 64)
+		case "x-request-id":
+			v = e.RequestID
+		case "x-trace-id":
+			v = e.TraceID
+		case "x-span-id":
+			v = e.SpanID
+		case "x-route":
+			v = e.Route
+		case "cs(user-agent)":
+			v = e.UserAgent
+		case "cs(referer)":
+			v = e.Referer
+		}
+
+		buf.WriteString(w3cField(v))
+	}
+}
+
+// "-" for empty values, whitespace is replaced with + as fields are space separated
+func w3cField(v string) string {
+	if v == "" {
+		return "-"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return '+'
+		}
+
+		return r
+	}, v)
+}
+
+type templateFormat struct {
+	t *template.Template
+}
+
+// renders entries with a text/template executed against the *LogEntry, such as `{{.IP}} {{.Method}} {{.URI}} {{.Status}}`
+func TemplateLogFormat(text string) (LogFormatter, error) {
+	t, err := template.New("log").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &templateFormat{t: t}, nil
+}
+
+func (f *templateFormat) Format(buf *bytes.Buffer, e *LogEntry) {
+	if err := f.t.Execute(buf, e); err != nil {
+		buf.WriteString(err.Error())
+	}
+}
+
+var logBufferPool = sync.Pool{New: func() any {
+	return &bytes.Buffer{}
+}}
+
+// formats the entry as a newline terminated line and writes it to w in a single call
+func writeFormatted(w io.Writer, f LogFormatter, e *LogEntry) {
+	var buf = logBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	f.Format(buf, e)
+	buf.WriteByte('\n')
+
+	w.Write(buf.Bytes())
+
+	// don't keep unusually large lines around
+	if buf.Cap() <= 64<<10 {
+		logBufferPool.Put(buf)
+	}
+}
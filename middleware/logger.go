@@ -1,39 +1,412 @@
 package middleware
 
 import (
+	"context"
+	"io"
+	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
-	"log/slog"
-
+	"github.com/brody192/ext/variables"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
+// selects the fields included in access logs, combine with a bitwise or
+type LogField uint32
+
+const (
+	LogMethod LogField = 1 << iota
+	LogURI
+	LogUserAgent
+	LogIP
+	LogStatus
+	LogBytes
+	LogDuration
+	LogRequestID
+	LogReferer
+	LogProto
+	LogHost
+	LogRoute
+	LogRequestBytes
+	LogTrace
+)
+
+// the fields logged by Logger, the request id and trace ids are only included when they are set
+const DefaultLogFields = LogMethod | LogURI | LogUserAgent | LogIP | LogRequestID | LogTrace | LogStatus | LogBytes | LogDuration
+
+const redacted = "[REDACTED]"
+
+// headers that are redacted by default when listed in LoggerConfig.Headers
+var RedactedHeaders = []string{
+	variables.HeaderAuthorization,
+	variables.HeaderProxyAuthorization,
+	variables.HeaderCookie,
+	variables.HeaderSetCookie,
+}
+
+type LoggerConfig struct {
+	Logger *slog.Logger
+	// defaults to "handled request"
+	Message string
+	// defaults to DefaultLogFields
+	Fields LogField
+	// request headers to log under the headers group
+	Headers []string
+	// headers whose values are replaced before logging, defaults to RedactedHeaders
+	RedactHeaders []string
+	// query parameters whose values are replaced before logging the uri
+	RedactQueryParams []string
+	// maps the response status to a log level, defaults to always logging at info, see StatusLevel
+	Level func(status int) slog.Level
+	// paths that are never logged, such as /healthz, paths are cleaned before comparing
+	SkipPaths []string
+	// fraction of requests with a status below 400 that are logged, 0 logs every request
+	SampleRate float64
+
+	// renders entries as lines written to Output instead of logging them with Logger, see CommonLogFormat
+	Formatter LogFormatter
+	// defaults to os.Stdout, wrap with NewAsyncLogWriter to keep slow writers off the request path
+	Output io.Writer
+}
+
+func (c *LoggerConfig) loadDefaults() {
+	if c.Logger == nil {
+		c.Logger = slog.Default()
+	}
+
+	if c.Message == "" {
+		c.Message = "handled request"
+	}
+
+	if c.Fields == 0 {
+		c.Fields = DefaultLogFields
+	}
+
+	if c.RedactHeaders == nil {
+		c.RedactHeaders = RedactedHeaders
+	}
+
+	if c.Level == nil {
+		c.Level = func(int) slog.Level { return slog.LevelInfo }
+	}
+
+	if c.Formatter != nil && c.Output == nil {
+		c.Output = os.Stdout
+	}
+}
+
+// maps 5xx responses to error, 4xx responses to warn and everything else to info
+func StatusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	}
+
+	return slog.LevelInfo
+}
+
+// metrics gathered for a single request, passed to the slog backend or a LogFormatter
+type LogEntry struct {
+	// when the request was received
+	Time   time.Time
+	Method string
+	// request uri with redacted query parameters
+	URI   string
+	Proto string
+	Host  string
+	// chi route pattern that matched the request
+	Route     string
+	IP        string
+	User      string
+	UserAgent string
+	Referer   string
+	RequestID string
+	// set by TraceContext
+	TraceID      string
+	SpanID       string
+	Status       int
+	Bytes        int
+	RequestBytes int64
+	Duration     time.Duration
+	Headers      map[string]string
+}
+
 // logger middleware for access logs
 func Logger(logger *slog.Logger) func(http.Handler) http.Handler {
+	return LoggerWithConfig(&LoggerConfig{Logger: logger})
+}
+
+// logger middleware for access logs with configurable fields, levels, redaction, skipped paths and sampling
+func LoggerWithConfig(c *LoggerConfig) func(http.Handler) http.Handler {
+	c.loadDefaults()
+
+	var skipPaths = make(map[string]struct{}, len(c.SkipPaths))
+	for _, p := range c.SkipPaths {
+		skipPaths[path.Clean(p)] = struct{}{}
+	}
+
+	var redactHeaders = make(map[string]struct{}, len(c.RedactHeaders))
+	for _, h := range c.RedactHeaders {
+		redactHeaders[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+
+	if h, ok := c.Formatter.(LogHeaderFormatter); ok {
+		io.WriteString(c.Output, h.Header())
+	}
+
+	var redactQuery = make(map[string]struct{}, len(c.RedactQueryParams))
+	for _, q := range c.RedactQueryParams {
+		redactQuery[q] = struct{}{}
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := skipPaths[path.Clean(r.URL.Path)]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// gathers metrics from the upstream handlers
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
+			var body *countingReader
+			if c.Fields&LogRequestBytes != 0 && r.Body != nil && r.Body != http.NoBody {
+				body = &countingReader{ReadCloser: r.Body}
+				r.Body = body
+			}
+
 			st := time.Now()
 
 			next.ServeHTTP(ww, r)
 
 			et := time.Since(st)
 
+			var status = ww.Status()
+			if status == 0 {
+				// nothing was written, net/http responds with 200
+				status = http.StatusOK
+			}
+
+			if c.SampleRate > 0 && c.SampleRate < 1 && status < 400 && rand.Float64() >= c.SampleRate {
+				return
+			}
+
+			var entry = &LogEntry{
+				Time:      st,
+				Method:    r.Method,
+				URI:       redactURI(r.URL, redactQuery),
+				Proto:     r.Proto,
+				Host:      r.Host,
+				IP:        clientIP(r),
+				UserAgent: r.UserAgent(),
+				User:      requestUser(r),
+				Referer:   r.Referer(),
+				RequestID: requestID(r.Context()),
+				Status:    status,
+				Bytes:     ww.BytesWritten(),
+				Duration:  et,
+			}
+
+			if sc, ok := GetSpanContext(r.Context()); ok && sc.IsValid() {
+				entry.TraceID = sc.TraceID.String()
+				entry.SpanID = sc.SpanID.String()
+			}
+
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				entry.Route = rctx.RoutePattern()
+			}
+
+			if body != nil {
+				entry.RequestBytes = body.n
+			} else if r.ContentLength > 0 {
+				entry.RequestBytes = r.ContentLength
+			}
+
+			if len(c.Headers) > 0 {
+				entry.Headers = make(map[string]string, len(c.Headers))
+
+				for _, h := range c.Headers {
+					var value = r.Header.Get(h)
+					if value == "" {
+						continue
+					}
+
+					if _, ok := redactHeaders[http.CanonicalHeaderKey(h)]; ok {
+						value = redacted
+					}
+
+					entry.Headers[h] = value
+				}
+			}
+
+			if c.Formatter != nil {
+				writeFormatted(c.Output, c.Formatter, entry)
+				return
+			}
+
 			//print log and metrics
-			logger.Info(
-				"handled request",
-				slog.String("method", r.Method),
-				slog.String("uri", r.URL.RequestURI()),
-				slog.String("user_agent", r.Header.Get("User-Agent")),
-				slog.String("ip", r.RemoteAddr),
-				slog.Int("code", ww.Status()),
-				slog.Int("bytes", ww.BytesWritten()),
-				slog.String("request_time_pretty", et.String()),
-				slog.Int64("request_time_ns", et.Nanoseconds()),
-			)
+			c.Logger.LogAttrs(r.Context(), c.Level(status), c.Message, entry.attrs(c.Fields)...)
 		})
 	}
 }
+
+// builds the slog attributes for the selected fields
+func (e *LogEntry) attrs(fields LogField) []slog.Attr {
+	var attrs = make([]slog.Attr, 0, 16)
+
+	if fields&LogMethod != 0 {
+		attrs = append(attrs, slog.String("method", e.Method))
+	}
+
+	if fields&LogURI != 0 {
+		attrs = append(attrs, slog.String("uri", e.URI))
+	}
+
+	if fields&LogRoute != 0 && e.Route != "" {
+		attrs = append(attrs, slog.String("route", e.Route))
+	}
+
+	if fields&LogProto != 0 {
+		attrs = append(attrs, slog.String("proto", e.Proto))
+	}
+
+	if fields&LogHost != 0 {
+		attrs = append(attrs, slog.String("host", e.Host))
+	}
+
+	if fields&LogUserAgent != 0 {
+		attrs = append(attrs, slog.String("user_agent", e.UserAgent))
+	}
+
+	if fields&LogReferer != 0 && e.Referer != "" {
+		attrs = append(attrs, slog.String("referer", e.Referer))
+	}
+
+	if fields&LogIP != 0 {
+		attrs = append(attrs, slog.String("ip", e.IP))
+	}
+
+	if fields&LogRequestID != 0 && e.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", e.RequestID))
+	}
+
+	if fields&LogTrace != 0 && e.TraceID != "" {
+		attrs = append(attrs, slog.String("trace_id", e.TraceID), slog.String("span_id", e.SpanID))
+	}
+
+	if fields&LogStatus != 0 {
+		attrs = append(attrs, slog.Int("code", e.Status))
+	}
+
+	if fields&LogRequestBytes != 0 {
+		attrs = append(attrs, slog.Int64("request_bytes", e.RequestBytes))
+	}
+
+	if fields&LogBytes != 0 {
+		attrs = append(attrs, slog.Int("bytes", e.Bytes))
+	}
+
+	if fields&LogDuration != 0 {
+		attrs = append(attrs,
+			slog.String("request_time_pretty", e.Duration.String()),
+			slog.Int64("request_time_ns", e.Duration.Nanoseconds()),
+		)
+	}
+
+	if len(e.Headers) > 0 {
+		var names = make([]string, 0, len(e.Headers))
+		for h := range e.Headers {
+			names = append(names, h)
+		}
+
+		sort.Strings(names)
+
+		var headers = make([]any, 0, len(names))
+		for _, h := range names {
+			headers = append(headers, slog.String(h, e.Headers[h]))
+		}
+
+		attrs = append(attrs, slog.Group("headers", headers...))
+	}
+
+	return attrs
+}
+
+// the client IP resolved by TrustProxy, otherwise the remote address
+func clientIP(r *http.Request) string {
+	if ip := GetClientIP(r.Context()); ip.IsValid() {
+		return ip.String()
+	}
+
+	return r.RemoteAddr
+}
+
+// the basic auth user name or the user info from the url
+func requestUser(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+
+	if r.URL.User != nil {
+		return r.URL.User.Username()
+	}
+
+	return ""
+}
+
+// the request id set by RequestID, falls back to the one set by chi's RequestID middleware
+func requestID(ctx context.Context) string {
+	if id := GetRequestID(ctx); id != "" {
+		return id
+	}
+
+	return middleware.GetReqID(ctx)
+}
+
+// the request uri with the values of the given query parameters replaced, parameter order is kept
+func redactURI(u *url.URL, params map[string]struct{}) string {
+	var uri = u.RequestURI()
+
+	if len(params) == 0 || u.RawQuery == "" {
+		return uri
+	}
+
+	var pairs = strings.Split(u.RawQuery, "&")
+
+	for i, pair := range pairs {
+		var key, _, hasValue = strings.Cut(pair, "=")
+
+		if name, err := url.QueryUnescape(key); err == nil {
+			key = name
+		}
+
+		if _, ok := params[key]; ok && hasValue {
+			pairs[i] = pair[:strings.IndexByte(pair, '=')+1] + redacted
+		}
+	}
+
+	var base, _, _ = strings.Cut(uri, "?")
+
+	return base + "?" + strings.Join(pairs, "&")
+}
+
+// counts the bytes read from the request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	c.n += int64(n)
+	return n, err
+}
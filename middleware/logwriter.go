@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// returned by AsyncLogWriter.Write after Close
+var ErrLogWriterClosed = errors.New("log writer closed")
+
+// an io.Writer that queues writes and copies them to the underlying writer from a background goroutine
+//
+// writes never block, when the queue is full the line is dropped and counted, see Dropped
+type AsyncLogWriter struct {
+	w       *bufio.Writer
+	queue   chan []byte
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Uint64
+}
+
+// starts the background goroutine, queueSize defaults to 1024 lines
+//
+// output is buffered and flushed whenever the queue runs empty or at least once a second
+func NewAsyncLogWriter(w io.Writer, queueSize int) *AsyncLogWriter {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+
+	var a = &AsyncLogWriter{
+		w:     bufio.NewWriterSize(w, 32<<10),
+		queue: make(chan []byte, queueSize),
+		done:  make(chan struct{}),
+	}
+
+	go a.run()
+
+	return a
+}
+
+// queues a copy of p, always reports len(p) as written unless the writer is closed
+func (a *AsyncLogWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return 0, ErrLogWriterClosed
+	}
+
+	select {
+	case a.queue <- append([]byte(nil), p...):
+	default:
+		a.dropped.Add(1)
+	}
+
+	return len(p), nil
+}
+
+// number of writes dropped because the queue was full
+func (a *AsyncLogWriter) Dropped() uint64 {
+	return a.dropped.Load()
+}
+
+// writes everything still queued, flushes and stops the background goroutine
+func (a *AsyncLogWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+
+	return nil
+}
+
+func (a *AsyncLogWriter) run() {
+	defer close(a.done)
+
+	var ticker = time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case p, ok := <-a.queue:
+			if !ok {
+				a.w.Flush()
+				return
+			}
+
+			a.w.Write(p)
+
+			if len(a.queue) == 0 {
+				a.w.Flush()
+			}
+		case <-ticker.C:
+			a.w.Flush()
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"cmp"
+	"encoding/binary"
+	"net/netip"
+	"slices"
+	"sort"
+)
+
+// an immutable set of prefixes flattened into sorted, non-overlapping address ranges
+//
+// lookups are a binary search per address family, so thousands of cdn ranges cost a handful of comparisons
+type prefixSet struct {
+	v4 []range4
+	v6 []range6
+}
+
+type range4 struct {
+	first, last uint32
+}
+
+type uint128 struct {
+	hi, lo uint64
+}
+
+type range6 struct {
+	first, last uint128
+}
+
+func (u uint128) compare(o uint128) int {
+	if c := cmp.Compare(u.hi, o.hi); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(u.lo, o.lo)
+}
+
+func (u uint128) next() uint128 {
+	if u.lo == ^uint64(0) {
+		return uint128{hi: u.hi + 1}
+	}
+
+	return uint128{hi: u.hi, lo: u.lo + 1}
+}
+
+func newPrefixSet(prefixes []netip.Prefix) *prefixSet {
+	var s = &prefixSet{}
+
+	for _, prefix := range prefixes {
+		if !prefix.IsValid() {
+			continue
+		}
+
+		prefix = normalizePrefix(prefix)
+
+		if prefix.Addr().Is4() {
+			var first = binary.BigEndian.Uint32(prefix.Addr().AsSlice())
+			s.v4 = append(s.v4, range4{first: first, last: first | ^uint32(0)>>prefix.Bits()})
+			continue
+		}
+
+		var b = prefix.Addr().As16()
+		var first = uint128{hi: binary.BigEndian.Uint64(b[:8]), lo: binary.BigEndian.Uint64(b[8:])}
+		var last = first
+
+		switch bits := prefix.Bits(); {
+		case bits <= 64:
+			last.hi |= ^uint64(0) >> bits
+			last.lo = ^uint64(0)
+		case bits < 128:
+			last.lo |= ^uint64(0) >> (bits - 64)
+		}
+
+		s.v6 = append(s.v6, range6{first: first, last: last})
+	}
+
+	s.v4 = mergeRange4(s.v4)
+	s.v6 = mergeRange6(s.v6)
+
+	return s
+}
+
+// masks the prefix and turns IPv4-mapped IPv6 prefixes into their IPv4 form
+func normalizePrefix(prefix netip.Prefix) netip.Prefix {
+	prefix = prefix.Masked()
+
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	return prefix
+}
+
+// sorts the ranges and merges overlapping or adjacent ones
+func mergeRange4(ranges []range4) []range4 {
+	slices.SortFunc(ranges, func(a, b range4) int {
+		return cmp.Compare(a.first, b.first)
+	})
+
+	var merged = ranges[:0]
+
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && (merged[n-1].last == ^uint32(0) || r.first <= merged[n-1].last+1) {
+			merged[n-1].last = max(merged[n-1].last, r.last)
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return slices.Clip(merged)
+}
+
+// sorts the ranges and merges overlapping or adjacent ones
+func mergeRange6(ranges []range6) []range6 {
+	slices.SortFunc(ranges, func(a, b range6) int {
+		return a.first.compare(b.first)
+	})
+
+	var merged = ranges[:0]
+
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			var prev = &merged[n-1]
+			var full = prev.last == uint128{hi: ^uint64(0), lo: ^uint64(0)}
+
+			if full || r.first.compare(prev.last.next()) <= 0 {
+				if r.last.compare(prev.last) > 0 {
+					prev.last = r.last
+				}
+
+				continue
+			}
+		}
+
+		merged = append(merged, r)
+	}
+
+	return slices.Clip(merged)
+}
+
+// reports whether addr is within one of the prefixes
+//
+// IPv4-mapped IPv6 addresses match both the IPv4 ranges and the IPv6 ranges that cover ::ffff:0:0/96
+func (s *prefixSet) contains(addr netip.Addr) bool {
+	if addr.Is4() || addr.Is4In6() {
+		if s.contains4(addr.Unmap()) {
+			return true
+		}
+
+		if addr.Is4() {
+			return false
+		}
+	}
+
+	if !addr.Is6() {
+		return false
+	}
+
+	return s.contains6(addr)
+}
+
+func (s *prefixSet) contains4(addr netip.Addr) bool {
+	var b = addr.As4()
+	var ip = binary.BigEndian.Uint32(b[:])
+	var i = sort.Search(len(s.v4), func(i int) bool { return s.v4[i].last >= ip })
+
+	return i < len(s.v4) && s.v4[i].first <= ip
+}
+
+func (s *prefixSet) contains6(addr netip.Addr) bool {
+	var b = addr.As16()
+	var ip = uint128{hi: binary.BigEndian.Uint64(b[:8]), lo: binary.BigEndian.Uint64(b[8:])}
+	var i = sort.Search(len(s.v6), func(i int) bool { return s.v6[i].last.compare(ip) >= 0 })
+
+	return i < len(s.v6) && s.v6[i].first.compare(ip) <= 0
+}
@@ -0,0 +1,237 @@
+package middleware
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"testing"
+)
+
+func mustPrefixes(t testing.TB, list ...string) []netip.Prefix {
+	t.Helper()
+
+	var prefixes = make([]netip.Prefix, 0, len(list))
+	for _, s := range list {
+		prefixes = append(prefixes, netip.MustParsePrefix(s))
+	}
+
+	return prefixes
+}
+
+func TestPrefixSetMerge(t *testing.T) {
+	var tests = []struct {
+		name     string
+		prefixes []string
+		v4       []range4
+		v6       int
+	}{
+		{
+			name:     "overlapping",
+			prefixes: []string{"10.0.0.0/8", "10.1.0.0/16"},
+			v4:       []range4{{first: 0x0a000000, last: 0x0affffff}},
+		},
+		{
+			name:     "adjacent",
+			prefixes: []string{"10.0.0.0/25", "10.0.0.128/25"},
+			v4:       []range4{{first: 0x0a000000, last: 0x0a0000ff}},
+		},
+		{
+			name:     "disjoint",
+			prefixes: []string{"192.168.0.0/16", "10.0.0.0/8"},
+			v4:       []range4{{first: 0x0a000000, last: 0x0affffff}, {first: 0xc0a80000, last: 0xc0a8ffff}},
+		},
+		{
+			name:     "unmasked",
+			prefixes: []string{"10.0.0.7/24"},
+			v4:       []range4{{first: 0x0a000000, last: 0x0a0000ff}},
+		},
+		{
+			name:     "4in6 becomes v4",
+			prefixes: []string{"::ffff:10.0.0.0/104"},
+			v4:       []range4{{first: 0x0a000000, last: 0x0affffff}},
+		},
+		{
+			name:     "everything v4",
+			prefixes: []string{"0.0.0.0/0", "255.255.255.255/32"},
+			v4:       []range4{{first: 0, last: 0xffffffff}},
+		},
+		{
+			name:     "v6 overlapping and adjacent",
+			prefixes: []string{"2001:db8::/32", "2001:db8:1::/48", "2001:db9::/32", "fd00::/8"},
+			v6:       2,
+		},
+		{
+			name:     "everything v6",
+			prefixes: []string{"::/0", "::1/128", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"},
+			v6:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s = newPrefixSet(mustPrefixes(t, tt.prefixes...))
+
+			if len(s.v4) != len(tt.v4) {
+				t.Fatalf("got %d v4 ranges %v, want %v", len(s.v4), s.v4, tt.v4)
+			}
+
+			for i := range tt.v4 {
+				if s.v4[i] != tt.v4[i] {
+					t.Errorf("v4 range %d = %#x-%#x, want %#x-%#x", i, s.v4[i].first, s.v4[i].last, tt.v4[i].first, tt.v4[i].last)
+				}
+			}
+
+			if len(s.v6) != tt.v6 {
+				t.Errorf("got %d v6 ranges, want %d", len(s.v6), tt.v6)
+			}
+		})
+	}
+}
+
+func TestPrefixSetContains(t *testing.T) {
+	var tests = []struct {
+		name     string
+		prefixes []string
+		addr     string
+		want     bool
+	}{
+		{"v4 /0", []string{"0.0.0.0/0"}, "203.0.113.9", true},
+		{"v4 /0 mapped", []string{"0.0.0.0/0"}, "::ffff:203.0.113.9", true},
+		{"v4 /0 not v6", []string{"0.0.0.0/0"}, "2001:db8::1", false},
+		{"v4 /32 hit", []string{"10.0.0.1/32"}, "10.0.0.1", true},
+		{"v4 /32 below", []string{"10.0.0.1/32"}, "10.0.0.0", false},
+		{"v4 /32 above", []string{"10.0.0.1/32"}, "10.0.0.2", false},
+		{"v4 last address", []string{"255.255.255.255/32"}, "255.255.255.255", true},
+		{"v4 first address", []string{"0.0.0.0/32"}, "0.0.0.0", true},
+		{"v6 /0", []string{"::/0"}, "2001:db8::1", true},
+		{"v6 /0 mapped", []string{"::/0"}, "::ffff:10.0.0.1", true},
+		{"v6 /0 not v4", []string{"::/0"}, "10.0.0.1", false},
+		{"v6 /96 mapped", []string{"::ffff:0:0/96"}, "::ffff:10.0.0.1", true},
+		{"v6 /64 first", []string{"2001:db8:0:1::/64"}, "2001:db8:0:1::", true},
+		{"v6 /64 last", []string{"2001:db8:0:1::/64"}, "2001:db8:0:1:ffff:ffff:ffff:ffff", true},
+		{"v6 /64 below", []string{"2001:db8:0:1::/64"}, "2001:db8:0:0:ffff:ffff:ffff:ffff", false},
+		{"v6 /64 above", []string{"2001:db8:0:1::/64"}, "2001:db8:0:2::", false},
+		{"v6 /128 hit", []string{"::1/128"}, "::1", true},
+		{"v6 /128 miss", []string{"::1/128"}, "::2", false},
+		{"v6 last address", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"}, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", true},
+		{"empty set", nil, "10.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s = newPrefixSet(mustPrefixes(t, tt.prefixes...))
+
+			if got := s.contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("contains(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+// random prefixes and addresses around them, checked against a linear scan with netip.Prefix.Contains
+func TestPrefixSetMatchesLinearScan(t *testing.T) {
+	var rng = rand.New(rand.NewPCG(1, 2))
+	var prefixes = randomPrefixes(rng, 500, 500)
+	var s = newPrefixSet(prefixes)
+
+	for i := 0; i < 20000; i++ {
+		var addr = nearbyAddr(rng, prefixes[rng.IntN(len(prefixes))])
+
+		var want = false
+		for _, p := range prefixes {
+			if p.Contains(addr) {
+				want = true
+				break
+			}
+		}
+
+		if got := s.contains(addr); got != want {
+			t.Fatalf("contains(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func randomPrefixes(rng *rand.Rand, n4, n6 int) []netip.Prefix {
+	var prefixes = make([]netip.Prefix, 0, n4+n6)
+
+	for i := 0; i < n4; i++ {
+		var b [4]byte
+		for j := range b {
+			b[j] = byte(rng.UintN(256))
+		}
+
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom4(b), 12+rng.IntN(21)).Masked())
+	}
+
+	for i := 0; i < n6; i++ {
+		var b [16]byte
+		for j := range b {
+			b[j] = byte(rng.UintN(256))
+		}
+
+		prefixes = append(prefixes, netip.PrefixFrom(netip.AddrFrom16(b), 24+rng.IntN(105)).Masked())
+	}
+
+	return prefixes
+}
+
+// an address inside or just outside p
+func nearbyAddr(rng *rand.Rand, p netip.Prefix) netip.Addr {
+	var addr = p.Addr()
+
+	for i := rng.IntN(3); i > 0; i-- {
+		addr = addr.Prev()
+	}
+
+	for i := rng.IntN(4); i > 0; i-- {
+		if next := addr.Next(); next.IsValid() {
+			addr = next
+		}
+	}
+
+	if !addr.IsValid() {
+		return p.Addr()
+	}
+
+	return addr
+}
+
+func BenchmarkPrefixSetContains(b *testing.B) {
+	var rng = rand.New(rand.NewPCG(3, 4))
+	var prefixes = randomPrefixes(rng, 4000, 4000)
+	var s = newPrefixSet(prefixes)
+
+	var addrs = make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = nearbyAddr(rng, prefixes[rng.IntN(len(prefixes))])
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.contains(addrs[i%len(addrs)])
+	}
+}
+
+// the linear scan prefixSet replaced, for comparison
+func BenchmarkPrefixSliceContains(b *testing.B) {
+	var rng = rand.New(rand.NewPCG(3, 4))
+	var prefixes = randomPrefixes(rng, 4000, 4000)
+
+	var addrs = make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = nearbyAddr(rng, prefixes[rng.IntN(len(prefixes))])
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var addr = addrs[i%len(addrs)]
+		for _, p := range prefixes {
+			if p.Contains(addr) {
+				break
+			}
+		}
+	}
+}
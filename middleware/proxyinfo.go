@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+var proxyInfoCtxKey = &contextKey{"ProxyInfo"}
+
+// values resolved by TrustProxy, stored on the request context
+type ProxyInfo struct {
+	// r.RemoteAddr as received from the connecting peer
+	RemoteAddr string
+	// whether the connecting peer is within the trusted ranges, proxy headers are only used when true
+	Trusted bool
+
+	// resolved client address, the peer address when no trusted proxy header supplied one
+	ClientIP netip.Addr
+	// resolved scheme, http or https depending on the connection when no trusted proxy header supplied one
+	Scheme string
+	// resolved host without a port
+	Host string
+	// resolved port the client connected to, derived from the host or scheme when not supplied explicitly
+	Port string
+
+	// the header that supplied each value, empty when the value was derived from the request itself
+	ClientIPHeader string
+	SchemeHeader   string
+	HostHeader     string
+	PortHeader     string
+
+	// every address listed in ClientIPHeader, ordered from the client to the nearest proxy
+	Chain []string
+}
+
+// returns the ProxyInfo stored by TrustProxy, nil if TrustProxy did not run for this request
+func GetProxyInfo(ctx context.Context) *ProxyInfo {
+	if info, ok := ctx.Value(proxyInfoCtxKey).(*ProxyInfo); ok {
+		return info
+	}
+
+	return nil
+}
+
+// returns the client IP resolved by TrustProxy, the zero netip.Addr if TrustProxy did not run for this request
+func GetClientIP(ctx context.Context) netip.Addr {
+	if info := GetProxyInfo(ctx); info != nil {
+		return info.ClientIP
+	}
+
+	return netip.Addr{}
+}
+
+// returns r.RemoteAddr as it was before TrustProxy ran, empty if TrustProxy did not run for this request
+func GetOriginalRemoteAddr(ctx context.Context) string {
+	if info := GetProxyInfo(ctx); info != nil {
+		return info.RemoteAddr
+	}
+
+	return ""
+}
+
+// returns the address chain parsed from the proxy header that supplied the client IP,
+// ordered from the client to the nearest proxy
+//
+// returns nil if TrustProxy did not trust the request or no proxy header was present
+func GetProxyChain(ctx context.Context) []string {
+	if info := GetProxyInfo(ctx); info != nil {
+		return info.Chain
+	}
+
+	return nil
+}
+
+// fills in the values derived from the request itself, used for anything a trusted proxy did not supply
+func newProxyInfo(r *http.Request, peer netip.Addr) *ProxyInfo {
+	var info = &ProxyInfo{
+		RemoteAddr: r.RemoteAddr,
+		ClientIP:   peer,
+		Scheme:     "http",
+	}
+
+	if r.TLS != nil {
+		info.Scheme = "https"
+	}
+
+	info.Host, info.Port = splitHostPort(r.Host)
+
+	return info
+}
+
+// splits a host header value, the port is empty when the value does not include one
+func splitHostPort(hostport string) (string, string) {
+	if host, port, err := net.SplitHostPort(hostport); err == nil {
+		return host, port
+	}
+
+	return hostport, ""
+}
+
+// default port for the scheme, empty for unknown schemes
+func schemePort(scheme string) string {
+	switch scheme {
+	case "http", "ws":
+		return "80"
+	case "https", "wss":
+		return "443"
+	}
+
+	return ""
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/brody192/ext/utilities"
+	"github.com/brody192/ext/variables"
+)
+
+type RequestIDConfig struct {
+	// header the id is read from and echoed on, defaults to variables.HeaderXRequestID
+	Header string
+	// use a valid id from the inbound header instead of generating one
+	TrustInbound bool
+	// only use the inbound id when TrustProxy ran first and trusted the connecting peer
+	TrustedPeersOnly bool
+	// inbound ids longer than this are replaced, defaults to 128
+	MaxLength int
+	// generates new ids, defaults to UUIDv7, see ULID
+	Generator func() string
+}
+
+func (c *RequestIDConfig) loadDefaults() {
+	if c.Header == "" {
+		c.Header = variables.HeaderXRequestID
+	}
+
+	if c.MaxLength <= 0 {
+		c.MaxLength = 128
+	}
+
+	if c.Generator == nil {
+		c.Generator = UUIDv7
+	}
+}
+
+// stores a request id on the context and echoes it on the response header
+//
+// the id is picked up by Logger and the respond package
+func RequestID(c *RequestIDConfig) func(http.Handler) http.Handler {
+	c.loadDefaults()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var id string
+
+			if c.TrustInbound && (!c.TrustedPeersOnly || isTrustedPeer(r.Context())) {
+				if inbound := r.Header.Get(c.Header); isValidRequestID(inbound, c.MaxLength) {
+					id = inbound
+				}
+			}
+
+			if id == "" {
+				id = c.Generator()
+			}
+
+			w.Header().Set(c.Header, id)
+
+			next.ServeHTTP(w, r.WithContext(utilities.WithRequestID(r.Context(), id, c.Header)))
+		})
+	}
+}
+
+// returns the request id stored by RequestID, empty if there is none
+func GetRequestID(ctx context.Context) string {
+	return utilities.GetRequestID(ctx)
+}
+
+func isTrustedPeer(ctx context.Context) bool {
+	var info = GetProxyInfo(ctx)
+	return info != nil && info.Trusted
+}
+
+// ids are limited to printable characters that are safe to log and echo in a header
+func isValidRequestID(id string, maxLength int) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+', c == '/', c == '=', c == '@':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// generates a RFC 9562 version 7 UUID, time ordered with millisecond precision
+func UUIDv7() string {
+	var b [16]byte
+	rand.Read(b[6:])
+
+	var ms = uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+
+	return string(s[:])
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// generates a ULID, a 26 character lexicographically sortable id with millisecond precision
+func ULID() string {
+	var b [16]byte
+	rand.Read(b[6:])
+
+	var ms = uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	var hi = binary.BigEndian.Uint64(b[:8])
+	var lo = binary.BigEndian.Uint64(b[8:])
+
+	// 128 bits encoded as 26 characters of 5 bits, the first character only holds 3 bits
+	var s [26]byte
+	for i := 25; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(s[:])
+}
@@ -0,0 +1,249 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+var serverTimingCtxKey = &contextKey{"ServerTiming"}
+
+// a single Server-Timing metric such as `db;dur=12.3;desc="query"`
+type ServerTimingMetric struct {
+	Name        string
+	Duration    time.Duration
+	Description string
+}
+
+// metrics recorded for the current request, safe for concurrent use
+//
+// all methods are no-ops on a nil *ServerTimings so handlers work without the middleware
+type ServerTimings struct {
+	mu      sync.Mutex
+	metrics []ServerTimingMetric
+}
+
+// records a metric with a known duration
+func (t *ServerTimings) Add(name string, dur time.Duration, desc string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.metrics = append(t.metrics, ServerTimingMetric{Name: name, Duration: dur, Description: desc})
+	t.mu.Unlock()
+}
+
+// starts timing a metric, the returned function records it when called
+//
+// call it before the response is written, see ServerTiming
+//
+//	var stop = timings.Start("db", "query")
+//	rows, err := db.QueryContext(ctx, query)
+//	stop()
+func (t *ServerTimings) Start(name, desc string) func() {
+	var st = time.Now()
+
+	return func() {
+		t.Add(name, time.Since(st), desc)
+	}
+}
+
+// returns the metrics recorded so far
+func (t *ServerTimings) Metrics() []ServerTimingMetric {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]ServerTimingMetric(nil), t.metrics...)
+}
+
+// returns the metrics recorded after the first n
+func (t *ServerTimings) since(n int) []ServerTimingMetric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]ServerTimingMetric(nil), t.metrics[n:]...)
+}
+
+// returns the ServerTimings stored by ServerTiming, nil if the middleware did not run
+func GetServerTimings(ctx context.Context) *ServerTimings {
+	if t, ok := ctx.Value(serverTimingCtxKey).(*ServerTimings); ok {
+		return t
+	}
+
+	return nil
+}
+
+// records a metric with a known duration on the request's ServerTimings
+func AddServerTiming(ctx context.Context, name string, dur time.Duration, desc string) {
+	GetServerTimings(ctx).Add(name, dur, desc)
+}
+
+// starts timing a metric on the request's ServerTimings, the returned function records it when called
+func StartServerTiming(ctx context.Context, name, desc string) func() {
+	return GetServerTimings(ctx).Start(name, desc)
+}
+
+// collects metrics recorded through the context API and emits them as a Server-Timing header
+// together with a total metric for the time spent before the headers were written
+//
+// metrics must be recorded before the first write to reach responses that set a content length,
+// which includes everything written by the buffered respond helpers
+//
+// responses without a content length declare a Server-Timing trailer when their headers are written,
+// it carries the metrics recorded after that point and the final total
+func ServerTiming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tw = &serverTimingWriter{
+			ResponseWriter: w,
+			timings:        &ServerTimings{},
+			start:          time.Now(),
+		}
+
+		next.ServeHTTP(tw, r.WithContext(context.WithValue(r.Context(), serverTimingCtxKey, tw.timings)))
+
+		if !tw.wroteHeader {
+			// nothing was written, every metric fits in the header
+			tw.writeTimingHeader(false)
+			return
+		}
+
+		var late = tw.timings.since(tw.emitted)
+		late = append(late, ServerTimingMetric{Name: "total", Duration: time.Since(tw.start)})
+
+		if tw.trailer {
+			// the header was already sent, the declared trailer takes its value from here
+			w.Header().Set(variables.HeaderServerTiming, formatServerTiming(late))
+			return
+		}
+
+		// a content length rules out trailers over HTTP/1.1, HTTP/2 still sends undeclared ones
+		if len(late) > 1 {
+			w.Header().Set(http.TrailerPrefix+variables.HeaderServerTiming, formatServerTiming(late))
+		}
+	})
+}
+
+type serverTimingWriter struct {
+	http.ResponseWriter
+	timings     *ServerTimings
+	start       time.Time
+	wroteHeader bool
+	// a Server-Timing trailer was declared
+	trailer bool
+	// number of metrics already sent in the header
+	emitted int
+}
+
+// sets the Server-Timing header, declaring the trailer when asked to and the response has no content length
+func (w *serverTimingWriter) writeTimingHeader(declareTrailer bool) {
+	if w.wroteHeader {
+		return
+	}
+
+	w.wroteHeader = true
+
+	var metrics = w.timings.Metrics()
+	w.emitted = len(metrics)
+
+	var h = w.ResponseWriter.Header()
+
+	metrics = append(metrics, ServerTimingMetric{Name: "total", Duration: time.Since(w.start)})
+	h.Set(variables.HeaderServerTiming, formatServerTiming(metrics))
+
+	if declareTrailer && h.Get(variables.HeaderContentLength) == "" {
+		h.Add(variables.HeaderTrailer, variables.HeaderServerTiming)
+		w.trailer = true
+	}
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	// informational responses don't finalize the headers
+	if code >= 100 && code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	// these have no body to carry a trailer after
+	w.writeTimingHeader(code != http.StatusNoContent && code != http.StatusNotModified)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	w.writeTimingHeader(true)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *serverTimingWriter) Flush() {
+	w.FlushError()
+}
+
+// used by http.ResponseController, reports http.ErrNotSupported when the wrapped writer can't flush
+func (w *serverTimingWriter) FlushError() error {
+	w.writeTimingHeader(true)
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// allows http.ResponseController to reach the underlying writer
+func (w *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+var serverTimingEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// formats metrics as a Server-Timing header value, durations are in milliseconds
+//
+// characters a metric name can't hold are replaced with _, metrics without a name are dropped
+func formatServerTiming(metrics []ServerTimingMetric) string {
+	var b strings.Builder
+
+	for _, m := range metrics {
+		var name = serverTimingName(m.Name)
+		if name == "" {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+
+		b.WriteString(name)
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(m.Duration.Microseconds())/1000, 'f', -1, 64))
+
+		if m.Description != "" {
+			b.WriteString(`;desc="`)
+			b.WriteString(serverTimingEscaper.Replace(m.Description))
+			b.WriteByte('"')
+		}
+	}
+
+	return b.String()
+}
+
+// makes name an RFC 9110 token by replacing every other byte with _
+func serverTimingName(name string) string {
+	var b = []byte(name)
+	for i, c := range b {
+		if !isTokenChar(c) {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+// tchar from RFC 9110 section 5.6.2
+func isTokenChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
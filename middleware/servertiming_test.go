@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+func serveTiming(t *testing.T, h http.HandlerFunc) *http.Response {
+	t.Helper()
+
+	var srv = httptest.NewServer(ServerTiming(h))
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// trailers are only filled in once the body is read
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestServerTimingBeforeWrite(t *testing.T) {
+	var resp = serveTiming(t, func(w http.ResponseWriter, r *http.Request) {
+		AddServerTiming(r.Context(), "db", 5*time.Millisecond, "query")
+
+		w.Header().Set(variables.HeaderContentLength, "2")
+		w.Write([]byte("ok"))
+	})
+
+	var got = resp.Header.Get(variables.HeaderServerTiming)
+	if !strings.HasPrefix(got, `db;dur=5;desc="query", total;dur=`) {
+		t.Errorf("header = %q", got)
+	}
+
+	if resp.Header.Get(variables.HeaderTrailer) != "" || resp.Trailer.Get(variables.HeaderServerTiming) != "" {
+		t.Errorf("content length response declared a trailer: %v %v", resp.Header, resp.Trailer)
+	}
+}
+
+func TestServerTimingTrailerWithoutContentLength(t *testing.T) {
+	var resp = serveTiming(t, func(w http.ResponseWriter, r *http.Request) {
+		var stop = StartServerTiming(r.Context(), "render", "")
+
+		w.Write([]byte("ok"))
+		stop()
+	})
+
+	if got := resp.Header.Get(variables.HeaderServerTiming); !strings.HasPrefix(got, "total;dur=") {
+		t.Errorf("header = %q", got)
+	}
+
+	var got = resp.Trailer.Get(variables.HeaderServerTiming)
+	if !strings.HasPrefix(got, "render;dur=") || !strings.Contains(got, ", total;dur=") {
+		t.Errorf("trailer = %q", got)
+	}
+}
+
+func TestServerTimingNothingWritten(t *testing.T) {
+	var resp = serveTiming(t, func(w http.ResponseWriter, r *http.Request) {
+		AddServerTiming(r.Context(), "cache", 0, "miss")
+	})
+
+	if got := resp.Header.Get(variables.HeaderServerTiming); !strings.HasPrefix(got, `cache;dur=0;desc="miss", total;dur=`) {
+		t.Errorf("header = %q", got)
+	}
+
+	if resp.Header.Get(variables.HeaderTrailer) != "" {
+		t.Errorf("empty response declared a trailer")
+	}
+}
+
+func TestFormatServerTimingNames(t *testing.T) {
+	var got = formatServerTiming([]ServerTimingMetric{
+		{Name: "db query", Duration: time.Millisecond},
+		{Name: "", Duration: time.Millisecond},
+		{Name: "cache;hit", Description: `say "hi"`},
+		{Name: "ümlaut"},
+		{Name: "ok.name-1_x"},
+	})
+
+	var want = `db_query;dur=1, cache_hit;dur=0;desc="say \"hi\"", __mlaut;dur=0, ok.name-1_x;dur=0`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// a ResponseWriter that can't flush
+type noFlushWriter struct {
+	http.ResponseWriter
+}
+
+func TestServerTimingFlushError(t *testing.T) {
+	var h = ServerTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).Flush(); !errors.Is(err, http.ErrNotSupported) {
+			t.Errorf("flush through a writer that can't flush = %v, want http.ErrNotSupported", err)
+		}
+	}))
+
+	h.ServeHTTP(noFlushWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	h = ServerTiming(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush = %v", err)
+		}
+	}))
+
+	var rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !rec.Flushed {
+		t.Error("the wrapped writer was not flushed")
+	}
+}
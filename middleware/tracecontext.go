@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/brody192/ext/variables"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+var spanContextCtxKey = &contextKey{"SpanContext"}
+
+var (
+	ErrInvalidTraceparent = errors.New("invalid traceparent")
+	ErrInvalidTracestate  = errors.New("invalid tracestate")
+)
+
+// W3C trace context sampled flag
+const TraceFlagSampled byte = 0x01
+
+type TraceID [16]byte
+
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// identifies the span handling the current request, stored on the request context by TraceContext
+type SpanContext struct {
+	TraceID TraceID
+	// span of the current request
+	SpanID SpanID
+	// span id received in the inbound traceparent, zero for new traces
+	ParentSpanID SpanID
+	Flags        byte
+	// validated tracestate, passed on unchanged
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&TraceFlagSampled != 0
+}
+
+// formats the span context as a version 00 traceparent header value
+func (sc SpanContext) Traceparent() string {
+	var b [55]byte
+
+	copy(b[:], "00-")
+	hex.Encode(b[3:35], sc.TraceID[:])
+	b[35] = '-'
+	hex.Encode(b[36:52], sc.SpanID[:])
+	b[52] = '-'
+	hex.Encode(b[53:55], []byte{sc.Flags})
+
+	return string(b[:])
+}
+
+// parses a traceparent header value, the returned SpanContext has the inbound span id as its SpanID
+//
+// future versions are accepted as long as they start with the version 00 fields, as required by the spec
+func ParseTraceparent(v string) (SpanContext, error) {
+	var sc SpanContext
+
+	v = strings.TrimSpace(v)
+
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+
+	var version [1]byte
+	if !decodeLowerHex(version[:], v[0:2]) || version[0] == 0xff {
+		return sc, ErrInvalidTraceparent
+	}
+
+	if (version[0] == 0 && len(v) != 55) || (len(v) > 55 && v[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+
+	var flags [1]byte
+	if !decodeLowerHex(sc.TraceID[:], v[3:35]) || !decodeLowerHex(sc.SpanID[:], v[36:52]) || !decodeLowerHex(flags[:], v[53:55]) {
+		return sc, ErrInvalidTraceparent
+	}
+
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+
+	sc.Flags = flags[0]
+
+	// only the sampled flag is defined for version 00
+	if version[0] == 0 {
+		sc.Flags &= TraceFlagSampled
+	}
+
+	return sc, nil
+}
+
+// hex decodes s into dst, rejecting upper case digits as the spec requires
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+
+	var n, err = hex.Decode(dst, []byte(s))
+
+	return err == nil && n == len(dst)
+}
+
+// validates a tracestate header value, returns it with empty list members removed
+func ParseTracestate(v string) (string, error) {
+	var members = make([]string, 0, 4)
+	var seen = make(map[string]struct{}, 4)
+
+	for _, member := range strings.Split(v, ",") {
+		member = strings.Trim(member, " \t")
+		if member == "" {
+			continue
+		}
+
+		var key, value, ok = strings.Cut(member, "=")
+		if !ok || !isValidTracestateKey(key) || !isValidTracestateValue(value) {
+			return "", ErrInvalidTracestate
+		}
+
+		if _, dup := seen[key]; dup {
+			return "", ErrInvalidTracestate
+		}
+
+		seen[key] = struct{}{}
+		members = append(members, member)
+	}
+
+	if len(members) > 32 {
+		return "", ErrInvalidTracestate
+	}
+
+	return strings.Join(members, ","), nil
+}
+
+func isValidTracestateKey(key string) bool {
+	var tenant, system, multi = strings.Cut(key, "@")
+
+	if !multi {
+		return len(key) <= 256 && isTracestateKeyPart(key, true)
+	}
+
+	return len(tenant) <= 241 && len(system) <= 14 &&
+		isTracestateKeyPart(tenant, false) && isTracestateKeyPart(system, true)
+}
+
+// lcalpha followed by lcalpha, digits and _ - * /, tenant ids may also start with a digit
+func isTracestateKeyPart(s string, alphaFirst bool) bool {
+	if s == "" {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+		var alpha = c >= 'a' && c <= 'z'
+		var digit = c >= '0' && c <= '9'
+
+		if i == 0 {
+			if !alpha && (alphaFirst || !digit) {
+				return false
+			}
+
+			continue
+		}
+
+		if !alpha && !digit && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isValidTracestateValue(value string) bool {
+	if value == "" || len(value) > 256 || value[len(value)-1] == ' ' {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newTraceID() TraceID {
+	var t TraceID
+	for !t.IsValid() {
+		rand.Read(t[:])
+	}
+
+	return t
+}
+
+func newSpanID() SpanID {
+	var s SpanID
+	for !s.IsValid() {
+		rand.Read(s[:])
+	}
+
+	return s
+}
+
+// returns the span context stored by TraceContext
+func GetSpanContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextCtxKey).(SpanContext)
+	return sc, ok
+}
+
+// starts spans for a tracing sdk such as OpenTelemetry, used by TraceContext in place of its own id generation
+type Tracer interface {
+	// starts a server span for the request, parent is the zero SpanContext when no valid traceparent was received
+	//
+	// returns the context carrying the sdk's span, the new span's context and a function ending the span
+	Start(r *http.Request, parent SpanContext) (context.Context, SpanContext, func(status int))
+}
+
+type TraceContextConfig struct {
+	// optional adapter for a tracing sdk
+	Tracer Tracer
+	// decides whether new traces are sampled, defaults to sampling every trace
+	Sampler func(r *http.Request) bool
+}
+
+// W3C trace context propagation
+//
+// parses and validates traceparent and tracestate, continuing the inbound trace with a new span
+// or starting a new trace when they are absent or invalid, then stores the span context on the
+// request context and emits traceparent on the response
+func TraceContext(c *TraceContextConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var parent, err = ParseTraceparent(r.Header.Get(variables.HeaderTraceparent))
+			if err == nil {
+				if state, err := ParseTracestate(strings.Join(r.Header.Values(variables.HeaderTracestate), ",")); err == nil {
+					parent.TraceState = state
+				}
+			} else {
+				parent = SpanContext{}
+			}
+
+			if c.Tracer != nil {
+				ctx, sc, end := c.Tracer.Start(r, parent)
+				ctx = context.WithValue(ctx, spanContextCtxKey, sc)
+
+				setTraceHeaders(w, sc)
+
+				ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+				defer func() {
+					var status = ww.Status()
+					if status == 0 {
+						status = http.StatusOK
+					}
+
+					end(status)
+				}()
+
+				next.ServeHTTP(ww, r.WithContext(ctx))
+				return
+			}
+
+			var sc = SpanContext{
+				TraceID:      parent.TraceID,
+				SpanID:       newSpanID(),
+				ParentSpanID: parent.SpanID,
+				Flags:        parent.Flags,
+				TraceState:   parent.TraceState,
+			}
+
+			if !parent.IsValid() {
+				sc.TraceID = newTraceID()
+
+				if c.Sampler == nil || c.Sampler(r) {
+					sc.Flags = TraceFlagSampled
+				}
+			}
+
+			setTraceHeaders(w, sc)
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), spanContextCtxKey, sc)))
+		})
+	}
+}
+
+func setTraceHeaders(w http.ResponseWriter, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+
+	w.Header().Set(variables.HeaderTraceparent, sc.Traceparent())
+
+	if sc.TraceState != "" {
+		w.Header().Set(variables.HeaderTracestate, sc.TraceState)
+	}
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	var tests = []struct {
+		name    string
+		value   string
+		flags   byte
+		wantErr bool
+	}{
+		{"valid", "00-" + testTraceID + "-" + testSpanID + "-01", 0x01, false},
+		{"not sampled", "00-" + testTraceID + "-" + testSpanID + "-00", 0x00, false},
+		{"surrounding whitespace", " 00-" + testTraceID + "-" + testSpanID + "-01\t", 0x01, false},
+		{"unknown flags dropped for version 00", "00-" + testTraceID + "-" + testSpanID + "-ff", 0x01, false},
+		{"future version", "01-" + testTraceID + "-" + testSpanID + "-03", 0x03, false},
+		{"future version with extra fields", "cc-" + testTraceID + "-" + testSpanID + "-01-what-the-future-will-be-like", 0x01, false},
+		{"future version with glued extra data", "cc-" + testTraceID + "-" + testSpanID + "-01what", 0, true},
+		{"version 00 with extra fields", "00-" + testTraceID + "-" + testSpanID + "-01-extra", 0, true},
+		{"version ff", "ff-" + testTraceID + "-" + testSpanID + "-01", 0, true},
+		{"uppercase trace id", "00-" + strings.ToUpper(testTraceID) + "-" + testSpanID + "-01", 0, true},
+		{"uppercase span id", "00-" + testTraceID + "-" + strings.ToUpper(testSpanID) + "-01", 0, true},
+		{"uppercase version", "0A-" + testTraceID + "-" + testSpanID + "-01", 0, true},
+		{"uppercase flags", "00-" + testTraceID + "-" + testSpanID + "-0A", 0, true},
+		{"all zero trace id", "00-" + strings.Repeat("0", 32) + "-" + testSpanID + "-01", 0, true},
+		{"all zero span id", "00-" + testTraceID + "-" + strings.Repeat("0", 16) + "-01", 0, true},
+		{"short trace id", "00-" + testTraceID[:30] + "-" + testSpanID + "-01", 0, true},
+		{"non hex", "00-" + strings.Repeat("g", 32) + "-" + testSpanID + "-01", 0, true},
+		{"wrong separators", "00_" + testTraceID + "_" + testSpanID + "_01", 0, true},
+		{"empty", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTraceparent) {
+					t.Fatalf("err = %v, want ErrInvalidTraceparent", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sc.TraceID.String() != testTraceID || sc.SpanID.String() != testSpanID || sc.Flags != tt.flags {
+				t.Errorf("got %s %s %02x", sc.TraceID, sc.SpanID, sc.Flags)
+			}
+		})
+	}
+}
+
+func TestParseTracestate(t *testing.T) {
+	var members = func(n int) string {
+		var list = make([]string, n)
+		for i := range list {
+			list[i] = fmt.Sprintf("k%d=v", i)
+		}
+
+		return strings.Join(list, ",")
+	}
+
+	var tests = []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"single", "rojo=00f067aa0ba902b7", "rojo=00f067aa0ba902b7", false},
+		{"several with whitespace and empty members", "rojo=1 ,\tcongo=t61rcWkgMzE, ,", "rojo=1,congo=t61rcWkgMzE", false},
+		{"multi tenant key", "fw529a3039@dt=abc,1tenant@vendor=x", "fw529a3039@dt=abc,1tenant@vendor=x", false},
+		{"key characters", "a_b-c*d/e=1", "a_b-c*d/e=1", false},
+		{"empty", "", "", false},
+		{"32 members", members(32), members(32), false},
+		{"33 members", members(33), "", true},
+		{"duplicate keys", "rojo=1,congo=2,rojo=3", "", true},
+		{"uppercase key", "Rojo=1", "", true},
+		{"key starting with a digit", "1rojo=1", "", true},
+		{"system id starting with a digit", "tenant@1vendor=1", "", true},
+		{"long key", strings.Repeat("a", 257) + "=1", "", true},
+		{"missing value", "rojo=", "", true},
+		{"missing equals", "rojo", "", true},
+		{"value with equals", "rojo=a=b", "", true},
+		{"value of only spaces", "rojo=   ,congo=1", "", true},
+		{"value with inner space and semicolon", "rojo=a b;c", "rojo=a b;c", false},
+		{"value with control character", "rojo=a\x01", "", true},
+		{"long value", "rojo=" + strings.Repeat("v", 257), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTracestate(tt.value)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTracestate) {
+					t.Fatalf("got %q %v, want ErrInvalidTracestate", got, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraceContextContinuesValidParent(t *testing.T) {
+	var tests = []struct {
+		name        string
+		traceparent string
+		tracestate  string
+		continued   bool
+		wantState   string
+	}{
+		{"valid parent", "00-" + testTraceID + "-" + testSpanID + "-01", "rojo=1", true, "rojo=1"},
+		{"invalid tracestate is dropped", "00-" + testTraceID + "-" + testSpanID + "-01", "rojo=1,rojo=2", true, ""},
+		{"invalid parent starts a new trace", "00-" + strings.ToUpper(testTraceID) + "-" + testSpanID + "-01", "rojo=1", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sc SpanContext
+			var h = TraceContext(&TraceContextConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sc, _ = GetSpanContext(r.Context())
+			}))
+
+			var r = httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(variables.HeaderTraceparent, tt.traceparent)
+			r.Header.Set(variables.HeaderTracestate, tt.tracestate)
+
+			var w = httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if !sc.IsValid() || sc.SpanID.String() == testSpanID {
+				t.Fatalf("span context %+v has no new span", sc)
+			}
+
+			if continued := sc.TraceID.String() == testTraceID; continued != tt.continued {
+				t.Errorf("continued = %v, want %v", continued, tt.continued)
+			}
+
+			if sc.TraceState != tt.wantState {
+				t.Errorf("tracestate = %q, want %q", sc.TraceState, tt.wantState)
+			}
+
+			if got := w.Header().Get(variables.HeaderTraceparent); got != sc.Traceparent() {
+				t.Errorf("response traceparent = %q, want %q", got, sc.Traceparent())
+			}
+		})
+	}
+}
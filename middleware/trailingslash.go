@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+
+	"github.com/brody192/ext/utilities"
 )
 
 // adds a trailing slash to the request path, uses http.StatusMovedPermanently
@@ -20,7 +22,7 @@ func AddTrailingSlash(next http.Handler) http.Handler {
 				uri += "?" + qs
 			}
 
-			http.Redirect(w, r, sanitizeURI(uri), http.StatusMovedPermanently)
+			http.Redirect(w, r, utilities.SanitizeURI(uri), http.StatusMovedPermanently)
 
 			r.RequestURI = path
 			r.URL.Path = path
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -8,6 +10,8 @@ import (
 	"net/netip"
 	"os"
 	"strings"
+
+	"github.com/brody192/ext/variables"
 )
 
 // PrivateRangesCIDR returns a list of private CIDR range
@@ -41,16 +45,51 @@ var xForwardedHosts = []string{
 	"X-Forwarded-Host",
 }
 
+var PortHeaders = []string{
+	"X-Forwarded-Port",
+}
+
+// the header lists are checked in order, the first header with a value is used
+//
+// include variables.HeaderForwarded (see ForwardedHeaders) in a list to parse the RFC 7239 Forwarded header for that value
 type TrustProxyConfig struct {
-	TrustIPRanges       []string
+	TrustIPRanges []string
+	// additional trusted ranges that can change at runtime, see NewFileRanges and NewURLRanges,
+	// TrustIPRanges no longer defaults to PrivateRanges when set
+	TrustRanges         RangeProvider
 	TrustIPHeaders      []string
 	TrustSchemeHeaders  []string
 	TrustForwardedHosts []string
+	TrustPortHeaders    []string
 	ErrorLogger         *slog.Logger
+	// writes the response when the remote address can't be parsed, defaults to the ErrorHandler on the request context
+	ErrorHandler ErrorHandler
+
+	// overwrite r.RemoteAddr, r.Host and r.URL.Scheme with the values passed by a trusted proxy,
+	// the resolved values are always available through GetProxyInfo
+	RewriteRequest bool
+
+	// how the client IP is picked from a header that carries a chain of addresses, defaults to ClientIPRightmost
+	ClientIPStrategy ClientIPStrategy
+	// number of trusted proxies in front of the server including the one connecting to it,
+	// only used with ClientIPTrustedHops
+	TrustedHops int
 }
 
+// strategy for picking the client IP out of a chain of addresses such as X-Forwarded-For
+type ClientIPStrategy int
+
+const (
+	// use the rightmost address, as appended by the nearest proxy
+	ClientIPRightmost ClientIPStrategy = iota
+	// walk the chain right to left skipping trusted addresses, the first untrusted address is the client
+	ClientIPRightmostUntrusted
+	// skip a fixed number of trusted proxies from the right, see TrustProxyConfig.TrustedHops
+	ClientIPTrustedHops
+)
+
 func (c *TrustProxyConfig) loadDefaults() {
-	if len(c.TrustIPRanges) == 0 {
+	if len(c.TrustIPRanges) == 0 && c.TrustRanges == nil {
 		c.TrustIPRanges = PrivateRanges
 	}
 
@@ -66,137 +105,325 @@ func (c *TrustProxyConfig) loadDefaults() {
 		c.TrustForwardedHosts = xForwardedHosts
 	}
 
+	if len(c.TrustPortHeaders) == 0 {
+		c.TrustPortHeaders = PortHeaders
+	}
+
 	if c.ErrorLogger == nil {
 		c.ErrorLogger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{}))
 	}
 }
 
-// TrustProxy checks if the request IP matches one of the provided ranges/IPs
-// then inspects common reverse proxy headers and sets the corresponding
-// fields in the HTTP request struct for use by middleware or handlers that are next
+// reports every invalid trusted range and setting at once, nil if the config is usable
+func (c *TrustProxyConfig) Validate() error {
+	var _, err = parseIPRanges(c.TrustIPRanges)
+
+	if c.ClientIPStrategy == ClientIPTrustedHops && c.TrustedHops < 1 {
+		err = errors.Join(err, fmt.Errorf("trusted hops must be at least 1 with ClientIPTrustedHops, got %d", c.TrustedHops))
+	}
+
+	return err
+}
+
+// same as NewTrustProxy but panics if the config is invalid
 func TrustProxy(c *TrustProxyConfig) func(http.Handler) http.Handler {
+	mw, err := NewTrustProxy(c)
+	if err != nil {
+		panic(err)
+	}
+
+	return mw
+}
+
+// NewTrustProxy checks if the request IP matches one of the provided ranges/IPs
+// then inspects common reverse proxy headers and stores the resolved values
+// on the request context as a ProxyInfo for use by middleware or handlers that are next
+//
+// the corresponding fields in the HTTP request struct are only overwritten when RewriteRequest is set
+//
+// returns the error from Validate if the config is invalid
+func NewTrustProxy(c *TrustProxyConfig) (func(http.Handler) http.Handler, error) {
 	c.loadDefaults()
 
-	// parse passed in trusted IPs into a 'netip.Prefix' slice
-	parsedIPs, err := parseIPRanges(c.TrustIPRanges)
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	// parse passed in trusted IPs into a 'netip.Prefix' set
+	staticRanges, err := NewStaticRanges(c.TrustIPRanges)
 	if err != nil {
-		c.ErrorLogger.Error(err.Error())
-		os.Exit(1)
+		return nil, err
+	}
+
+	var trustedRanges RangeProvider = staticRanges
+	if c.TrustRanges != nil {
+		trustedRanges = MultiRanges(staticRanges, c.TrustRanges)
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// check if RemoteAddr is trusted
-			trusted, err := isTrustedIP(r.RemoteAddr, parsedIPs)
+			// parse RemoteAddr
+			peer, err := parseRemoteAddr(r.RemoteAddr)
 			if err != nil {
 				c.ErrorLogger.Warn(err.Error(), slog.String("ip", r.RemoteAddr))
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				reject(w, r, c.ErrorHandler, fmt.Errorf("%w: %w", ErrInvalidRemoteAddr, err), http.StatusInternalServerError)
 				return
 			}
 
+			var info = newProxyInfo(r, peer)
+
+			// check if RemoteAddr is trusted
+			info.Trusted = trustedRanges.Contains(peer)
+
 			// if RemoteAddr is not trusted, serve next and return early without trusting any proxy headers
-			if !trusted {
-				next.ServeHTTP(w, r)
+			if !info.Trusted {
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyInfoCtxKey, info)))
 				return
 			}
 
 			// RemoteAddr is trusted
 
-			// Set the RemoteAddr with the value passed by the proxy
-			if realIP := c.getRealIP(r.Header); realIP != "" {
-				r.RemoteAddr = realIP
+			// the IP passed by the proxy
+			realIP, chain, ipHeader := c.getRealIP(r.Header, trustedRanges)
+			if clientIP, err := netip.ParseAddr(realIP); err == nil {
+				info.ClientIP = clientIP
+				info.ClientIPHeader = ipHeader
+			}
+
+			info.Chain = chain
+
+			// the host passed by the proxy
+			realHost, hostHeader := c.getRealHost(r.Header)
+			if realHost != "" {
+				info.Host, info.Port = splitHostPort(realHost)
+				info.HostHeader = hostHeader
+			}
+
+			// the scheme passed by the proxy
+			scheme, schemeHeader := c.getScheme(r.Header)
+			if scheme != "" {
+				info.Scheme = scheme
+				info.SchemeHeader = schemeHeader
 			}
 
-			// Set the host with the value passed by the proxy
-			if realHost := c.getRealHost(r.Header); realHost != "" {
-				r.Host = realHost
+			// the port passed by the proxy, otherwise the port from the host or the default for the scheme
+			if port, portHeader := c.getPort(r.Header); port != "" {
+				info.Port = port
+				info.PortHeader = portHeader
+			} else if info.Port == "" {
+				info.Port = schemePort(info.Scheme)
 			}
 
-			// Set the scheme with the value passed by the proxy
-			if scheme := c.getScheme(r.Header); scheme != "" {
-				r.URL.Scheme = scheme
+			if c.RewriteRequest {
+				// Set the RemoteAddr with the value passed by the proxy
+				if realIP != "" {
+					r.RemoteAddr = realIP
+				}
+
+				// Set the host with the value passed by the proxy
+				if realHost != "" {
+					r.Host = realHost
+				}
+
+				// Set the scheme with the value passed by the proxy
+				if scheme != "" {
+					r.URL.Scheme = scheme
+				}
 			}
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), proxyInfoCtxKey, info)))
 		})
-	}
+	}, nil
 }
 
 // parse passed in IP ranges into a 'netip.Prefix' slice
+//
+// every invalid range is reported in the returned error
 func parseIPRanges(IPRanges []string) ([]netip.Prefix, error) {
 	var parsedIPs []netip.Prefix
+	var errs []error
 
 	for _, ipStr := range IPRanges {
 		if strings.Contains(ipStr, "/") {
 			ipNet, err := netip.ParsePrefix(ipStr)
 			if err != nil {
-				return nil, fmt.Errorf("parsing CIDR expression: %w", err)
+				errs = append(errs, fmt.Errorf("parsing CIDR expression: %w", err))
+				continue
 			}
 
 			parsedIPs = append(parsedIPs, ipNet)
 		} else {
 			ipAddr, err := netip.ParseAddr(ipStr)
 			if err != nil {
-				return nil, fmt.Errorf("invalid IP address: '%s': %w", ipStr, err)
+				errs = append(errs, fmt.Errorf("invalid IP address: '%s': %w", ipStr, err))
+				continue
 			}
 
 			parsedIPs = append(parsedIPs, netip.PrefixFrom(ipAddr, ipAddr.BitLen()))
 		}
 	}
 
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
 	return parsedIPs, nil
 }
 
-// check if RemoteAddr is trusted
-func isTrustedIP(remoteAddr string, trustedIPs []netip.Prefix) (bool, error) {
+// parse RemoteAddr, with or without a port
+func parseRemoteAddr(remoteAddr string) (netip.Addr, error) {
 	ipStr, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
 		ipStr = remoteAddr
 	}
 
-	ipAddr, err := netip.ParseAddr(ipStr)
-	if err != nil {
-		return false, err
+	return netip.ParseAddr(ipStr)
+}
+
+// get the real IP, the full address chain and the header they came from if present
+func (c *TrustProxyConfig) getRealIP(headers http.Header, trustedRanges RangeProvider) (string, []string, string) {
+	for _, proxyHeader := range c.TrustIPHeaders {
+		var chain = c.getChain(headers, proxyHeader)
+		if len(chain) == 0 {
+			continue
+		}
+
+		return c.pickClientIP(chain, trustedRanges), chain, http.CanonicalHeaderKey(proxyHeader)
 	}
 
-	for _, ipRange := range trustedIPs {
-		if ipRange.Contains(ipAddr) {
-			return true, nil
+	return "", nil, ""
+}
+
+// get every address listed in the given header, across repeated header lines
+func (c *TrustProxyConfig) getChain(headers http.Header, proxyHeader string) []string {
+	var chain []string
+
+	if isForwardedHeader(proxyHeader) {
+		for _, element := range parseForwarded(headers.Values(variables.HeaderForwarded)) {
+			var addr, _ = splitForwardedNode(element.For)
+			if addr == "" {
+				// keep obfuscated identifiers so the chain stays complete
+				addr = element.For
+			}
+
+			chain = append(chain, addr)
 		}
+
+		return chain
 	}
 
-	return false, nil
+	for _, value := range headers.Values(proxyHeader) {
+		for _, ip := range strings.Split(value, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				chain = append(chain, ip)
+			}
+		}
+	}
+
+	return chain
 }
 
-// get the real IP from the proxy headers if present
-func (c *TrustProxyConfig) getRealIP(headers http.Header) string {
-	for _, proxyHeader := range c.TrustIPHeaders {
-		if value := headers.Get(proxyHeader); value != "" {
-			ips := strings.Split(value, ",")
-			return strings.TrimSpace(ips[len(ips)-1])
+// pick the client IP out of the chain according to the configured strategy
+//
+// returns an empty string if the picked entry is not an IP address
+func (c *TrustProxyConfig) pickClientIP(chain []string, trustedRanges RangeProvider) string {
+	switch c.ClientIPStrategy {
+	case ClientIPRightmostUntrusted:
+		for i := len(chain) - 1; i >= 0; i-- {
+			var addr, ok = parseChainAddr(chain[i])
+			if !ok {
+				return ""
+			}
+
+			if !trustedRanges.Contains(addr) {
+				return addr.String()
+			}
+		}
+
+		// every address is trusted, the leftmost is the closest we get to the client
+		return chainAddrString(chain[0])
+	case ClientIPTrustedHops:
+		var i = len(chain) - max(c.TrustedHops, 1)
+		if i < 0 {
+			i = 0
 		}
+
+		return chainAddrString(chain[i])
+	default:
+		return chainAddrString(chain[len(chain)-1])
+	}
+}
+
+// parse an entry of an address chain, entries may include a port
+func parseChainAddr(entry string) (netip.Addr, bool) {
+	if addr, err := netip.ParseAddr(entry); err == nil {
+		return addr, true
+	}
+
+	if addrPort, err := netip.ParseAddrPort(entry); err == nil {
+		return addrPort.Addr(), true
+	}
+
+	return netip.Addr{}, false
+}
+
+func chainAddrString(entry string) string {
+	if addr, ok := parseChainAddr(entry); ok {
+		return addr.String()
 	}
 
 	return ""
 }
 
-func (c *TrustProxyConfig) getRealHost(headers http.Header) string {
+// get the host and the header it came from if present
+func (c *TrustProxyConfig) getRealHost(headers http.Header) (string, string) {
 	for _, hostHeader := range c.TrustForwardedHosts {
+		if isForwardedHeader(hostHeader) {
+			if value := forwardedHost(headers); value != "" {
+				return value, variables.HeaderForwarded
+			}
+
+			continue
+		}
+
 		if value := headers.Get(hostHeader); value != "" {
-			return value
+			return value, http.CanonicalHeaderKey(hostHeader)
 		}
 	}
 
-	return ""
+	return "", ""
 }
 
-// get the scheme from the proxy headers if present
-func (c *TrustProxyConfig) getScheme(headers http.Header) string {
+// get the scheme and the header it came from if present
+func (c *TrustProxyConfig) getScheme(headers http.Header) (string, string) {
 	for _, schemaHeader := range c.TrustSchemeHeaders {
+		if isForwardedHeader(schemaHeader) {
+			if value := forwardedProto(headers); value != "" {
+				return value, variables.HeaderForwarded
+			}
+
+			continue
+		}
+
 		if value := headers.Get(schemaHeader); value != "" {
-			return strings.ToLower(value)
+			return strings.ToLower(value), http.CanonicalHeaderKey(schemaHeader)
 		}
 	}
 
-	return ""
+	return "", ""
+}
+
+// get the port and the header it came from if present
+func (c *TrustProxyConfig) getPort(headers http.Header) (string, string) {
+	for _, portHeader := range c.TrustPortHeaders {
+		if value := strings.TrimSpace(headers.Get(portHeader)); value != "" {
+			return value, http.CanonicalHeaderKey(portHeader)
+		}
+	}
+
+	return "", ""
+}
+
+func isForwardedHeader(header string) bool {
+	return http.CanonicalHeaderKey(header) == variables.HeaderForwarded
 }
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+// CDN → load balancer → app, the load balancer at 10.0.0.2 connects to the app
+// and the CDN's edge nodes live in 198.51.100.0/24
+func TestTrustProxyClientIPStrategies(t *testing.T) {
+	var tests = []struct {
+		name     string
+		strategy ClientIPStrategy
+		hops     int
+		peer     string
+		xff      []string
+		want     string
+	}{
+		{"rightmost", ClientIPRightmost, 0, "10.0.0.2:4000", []string{"203.0.113.7, 198.51.100.9"}, "198.51.100.9"},
+		{"rightmost untrusted skips cdn", ClientIPRightmostUntrusted, 0, "10.0.0.2:4000", []string{"203.0.113.7, 198.51.100.9"}, "203.0.113.7"},
+		{"rightmost untrusted ignores spoofed left entries", ClientIPRightmostUntrusted, 0, "10.0.0.2:4000", []string{"1.2.3.4, 203.0.113.7, 198.51.100.9, 10.0.0.3"}, "203.0.113.7"},
+		{"rightmost untrusted across header lines", ClientIPRightmostUntrusted, 0, "10.0.0.2:4000", []string{"203.0.113.7", "198.51.100.9"}, "203.0.113.7"},
+		{"rightmost untrusted with ports", ClientIPRightmostUntrusted, 0, "10.0.0.2:4000", []string{"[2001:db8::7]:5555, 198.51.100.9:443"}, "2001:db8::7"},
+		{"rightmost untrusted all trusted", ClientIPRightmostUntrusted, 0, "10.0.0.2:4000", []string{"10.0.0.9, 198.51.100.9"}, "10.0.0.9"},
+		{"rightmost untrusted stops at garbage", ClientIPRightmostUntrusted, 0, "10.0.0.2:4000", []string{"203.0.113.7, not-an-ip, 198.51.100.9"}, "10.0.0.2"},
+		{"trusted hops", ClientIPTrustedHops, 2, "10.0.0.2:4000", []string{"1.2.3.4, 203.0.113.7, 198.51.100.9"}, "203.0.113.7"},
+		{"trusted hops one", ClientIPTrustedHops, 1, "10.0.0.2:4000", []string{"203.0.113.7, 198.51.100.9"}, "198.51.100.9"},
+		{"trusted hops chain shorter than hops", ClientIPTrustedHops, 5, "10.0.0.2:4000", []string{"203.0.113.7, 198.51.100.9"}, "203.0.113.7"},
+		{"trusted hops lands on garbage", ClientIPTrustedHops, 2, "10.0.0.2:4000", []string{"garbage, 198.51.100.9"}, "10.0.0.2"},
+		{"rightmost garbage", ClientIPRightmost, 0, "10.0.0.2:4000", []string{"203.0.113.7, garbage"}, "10.0.0.2"},
+		{"untrusted peer ignores the header", ClientIPRightmostUntrusted, 0, "192.0.2.50:4000", []string{"203.0.113.7"}, "192.0.2.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := NewTrustProxy(&TrustProxyConfig{
+				TrustIPRanges:    []string{"10.0.0.0/8", "198.51.100.0/24"},
+				TrustIPHeaders:   []string{variables.HeaderXForwardedFor},
+				ClientIPStrategy: tt.strategy,
+				TrustedHops:      tt.hops,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var info *ProxyInfo
+			var h = mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				info = GetProxyInfo(r.Context())
+			}))
+
+			var r = httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.peer
+			for _, v := range tt.xff {
+				r.Header.Add(variables.HeaderXForwardedFor, v)
+			}
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if info == nil {
+				t.Fatal("no ProxyInfo on the request context")
+			}
+
+			if got := info.ClientIP.String(); got != tt.want {
+				t.Errorf("client ip = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustProxyChainAndHeader(t *testing.T) {
+	mw, err := NewTrustProxy(&TrustProxyConfig{
+		TrustIPRanges:    []string{"10.0.0.0/8"},
+		TrustIPHeaders:   ForwardedHeaders,
+		ClientIPStrategy: ClientIPRightmostUntrusted,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info *ProxyInfo
+	var h = mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = GetProxyInfo(r.Context())
+	}))
+
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:4000"
+	r.Header.Set(variables.HeaderForwarded, `for=_hidden, for="[2001:db8::7]:5555", for=10.0.0.3;proto=https`)
+
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := info.ClientIP.String(); got != "2001:db8::7" {
+		t.Errorf("client ip = %s, want 2001:db8::7", got)
+	}
+
+	if info.ClientIPHeader != variables.HeaderForwarded {
+		t.Errorf("client ip header = %q, want %q", info.ClientIPHeader, variables.HeaderForwarded)
+	}
+
+	if want := []string{"_hidden", "2001:db8::7", "10.0.0.3"}; !reflect.DeepEqual(info.Chain, want) {
+		t.Errorf("chain = %v, want %v", info.Chain, want)
+	}
+}
+
+func TestTrustProxyValidate(t *testing.T) {
+	if _, err := NewTrustProxy(&TrustProxyConfig{ClientIPStrategy: ClientIPTrustedHops}); err == nil {
+		t.Error("ClientIPTrustedHops without TrustedHops was accepted")
+	}
+
+	if _, err := NewTrustProxy(&TrustProxyConfig{TrustIPRanges: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("an invalid range was accepted")
+	}
+}
@@ -0,0 +1,404 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+// supplies the trusted proxy ranges for TrustProxy, implementations must be safe for concurrent use
+type RangeProvider interface {
+	// reports whether addr is within one of the current ranges
+	Contains(addr netip.Addr) bool
+}
+
+// parses a downloaded or on disk list of ranges
+type RangeParser func(data []byte) ([]netip.Prefix, error)
+
+// a set of ranges that can be swapped atomically while requests are being checked against it
+type rangeSet struct {
+	prefixes atomic.Pointer[prefixSet]
+}
+
+func (s *rangeSet) store(prefixes []netip.Prefix) {
+	s.prefixes.Store(newPrefixSet(prefixes))
+}
+
+func (s *rangeSet) contains(addr netip.Addr) bool {
+	var prefixes = s.prefixes.Load()
+	if prefixes == nil {
+		return false
+	}
+
+	return prefixes.contains(addr)
+}
+
+// a fixed list of trusted ranges
+type StaticRanges struct {
+	set rangeSet
+}
+
+// parses the given CIDR ranges and IPs into a RangeProvider
+//
+// every invalid range is reported in the returned error
+func NewStaticRanges(ranges []string) (*StaticRanges, error) {
+	prefixes, err := parseIPRanges(ranges)
+	if err != nil {
+		return nil, err
+	}
+
+	var s = &StaticRanges{}
+	s.set.store(prefixes)
+
+	return s, nil
+}
+
+func (s *StaticRanges) Contains(addr netip.Addr) bool {
+	return s.set.contains(addr)
+}
+
+type multiRanges []RangeProvider
+
+// combines providers, an address is trusted if any of them contains it
+func MultiRanges(providers ...RangeProvider) RangeProvider {
+	return multiRanges(providers)
+}
+
+func (m multiRanges) Contains(addr netip.Addr) bool {
+	for _, p := range m {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type FileRangesConfig struct {
+	// path of the file holding the ranges
+	Path string
+	// how often the file is checked for changes, defaults to 10 seconds
+	Interval time.Duration
+	// defaults to ParseRangeText
+	Parse       RangeParser
+	ErrorLogger *slog.Logger
+}
+
+func (c *FileRangesConfig) loadDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+
+	if c.Parse == nil {
+		c.Parse = ParseRangeText
+	}
+
+	if c.ErrorLogger == nil {
+		c.ErrorLogger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{}))
+	}
+}
+
+// trusted ranges loaded from a file that is reloaded whenever its size or modification time changes
+type FileRanges struct {
+	c       *FileRangesConfig
+	set     rangeSet
+	modTime time.Time
+	size    int64
+}
+
+// loads the ranges from the file and keeps watching it for changes until ctx is done
+//
+// returns an error if the initial load fails, failed reloads are logged and the previous ranges are kept
+func NewFileRanges(ctx context.Context, c *FileRangesConfig) (*FileRanges, error) {
+	c.loadDefaults()
+
+	var f = &FileRanges{c: c}
+
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+
+	go f.watch(ctx)
+
+	return f, nil
+}
+
+func (f *FileRanges) Contains(addr netip.Addr) bool {
+	return f.set.contains(addr)
+}
+
+func (f *FileRanges) watch(ctx context.Context) {
+	var ticker = time.NewTicker(f.c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := f.reload(); err != nil {
+				f.c.ErrorLogger.Error("reloading trusted ranges", slog.String("path", f.c.Path), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// reloads the file if it changed since the last load, reports whether the ranges were swapped
+func (f *FileRanges) reload() (bool, error) {
+	info, err := os.Stat(f.c.Path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(f.c.Path)
+	if err != nil {
+		return false, err
+	}
+
+	prefixes, err := f.c.Parse(data)
+	if err != nil {
+		return false, fmt.Errorf("parsing %s: %w", f.c.Path, err)
+	}
+
+	f.set.store(prefixes)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+
+	return true, nil
+}
+
+type URLRangesConfig struct {
+	// url returning the ranges
+	URL string
+	// how often the url is fetched, defaults to 1 hour
+	Interval time.Duration
+	// defaults to ParseRangeJSON for json responses and ParseRangeText otherwise,
+	// use RangeJSONParser for documents that nest their ranges in objects
+	Parse RangeParser
+	// largest response body accepted, defaults to 8 MiB
+	MaxSize int64
+	// defaults to a client with a 30 second timeout
+	Client      *http.Client
+	ErrorLogger *slog.Logger
+}
+
+func (c *URLRangesConfig) loadDefaults() {
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+
+	if c.MaxSize <= 0 {
+		c.MaxSize = 8 << 20
+	}
+
+	if c.Client == nil {
+		c.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	if c.ErrorLogger == nil {
+		c.ErrorLogger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{}))
+	}
+}
+
+// trusted ranges fetched from a url on an interval, such as a cdn's published egress ranges
+type URLRanges struct {
+	c   *URLRangesConfig
+	set rangeSet
+}
+
+// fetches the ranges from the url and keeps refreshing them on the configured interval until ctx is done
+//
+// returns an error if the initial fetch fails, failed refreshes are logged and the previous ranges are kept
+func NewURLRanges(ctx context.Context, c *URLRangesConfig) (*URLRanges, error) {
+	c.loadDefaults()
+
+	var u = &URLRanges{c: c}
+
+	if err := u.reload(ctx); err != nil {
+		return nil, err
+	}
+
+	go u.watch(ctx)
+
+	return u, nil
+}
+
+func (u *URLRanges) Contains(addr netip.Addr) bool {
+	return u.set.contains(addr)
+}
+
+func (u *URLRanges) watch(ctx context.Context) {
+	var ticker = time.NewTicker(u.c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.reload(ctx); err != nil && ctx.Err() == nil {
+				u.c.ErrorLogger.Error("refreshing trusted ranges", slog.String("url", u.c.URL), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (u *URLRanges) reload(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.c.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := u.c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: unexpected status %s", u.c.URL, res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, u.c.MaxSize+1))
+	if err != nil {
+		return err
+	}
+
+	if int64(len(data)) > u.c.MaxSize {
+		return fmt.Errorf("fetching %s: response larger than %d bytes", u.c.URL, u.c.MaxSize)
+	}
+
+	var parse = u.c.Parse
+	if parse == nil {
+		parse = ParseRangeText
+
+		if mediaType, _, _ := mime.ParseMediaType(res.Header.Get(variables.HeaderContentType)); strings.HasSuffix(mediaType, "json") {
+			parse = ParseRangeJSON
+		}
+	}
+
+	prefixes, err := parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", u.c.URL, err)
+	}
+
+	u.set.store(prefixes)
+
+	return nil
+}
+
+// parses one CIDR range or IP per line, blank lines and lines starting with # are ignored
+func ParseRangeText(data []byte) ([]netip.Prefix, error) {
+	var ranges []string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			ranges = append(ranges, line)
+		}
+	}
+
+	return parseIPRanges(ranges)
+}
+
+// parses a JSON array of CIDR ranges and IPs
+//
+// every string in the array must be a range, documents that nest their ranges in objects need RangeJSONParser
+func ParseRangeJSON(data []byte) ([]netip.Prefix, error) {
+	return parseRangeJSON(data, []string{""})
+}
+
+// returns a RangeParser that reads the ranges at the given paths of a JSON document
+//
+// a path is a dot separated list of object keys, arrays along the way are walked element by element,
+// and the empty path selects the document itself, for example
+//
+//	// Cloudflare's https://api.cloudflare.com/client/v4/ips
+//	RangeJSONParser("result.ipv4_cidrs", "result.ipv6_cidrs")
+//	// AWS's https://ip-ranges.amazonaws.com/ip-ranges.json
+//	RangeJSONParser("prefixes.ip_prefix", "ipv6_prefixes.ipv6_prefix")
+//
+// the selected values must be ranges or arrays of them, paths that don't exist in the document are skipped
+func RangeJSONParser(paths ...string) RangeParser {
+	return func(data []byte) ([]netip.Prefix, error) {
+		return parseRangeJSON(data, paths)
+	}
+}
+
+func parseRangeJSON(data []byte, paths []string) ([]netip.Prefix, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	var ranges []string
+
+	for _, path := range paths {
+		var keys []string
+		if path != "" {
+			keys = strings.Split(path, ".")
+		}
+
+		if err := selectJSONRanges(doc, keys, &ranges); err != nil {
+			return nil, fmt.Errorf("path %q: %w", path, err)
+		}
+	}
+
+	if len(ranges) == 0 {
+		return nil, errors.New("no ranges found in JSON document")
+	}
+
+	return parseIPRanges(ranges)
+}
+
+// appends the strings found by following keys from v, arrays are walked element by element
+func selectJSONRanges(v any, keys []string, ranges *[]string) error {
+	if arr, ok := v.([]any); ok {
+		for _, e := range arr {
+			if err := selectJSONRanges(e, keys, ranges); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(keys) == 0 {
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a range, got %T", v)
+		}
+
+		*ranges = append(*ranges, s)
+
+		return nil
+	}
+
+	m, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Errorf("expected an object at %q, got %T", keys[0], v)
+	}
+
+	e, ok := m[keys[0]]
+	if !ok {
+		return nil
+	}
+
+	return selectJSONRanges(e, keys[1:], ranges)
+}
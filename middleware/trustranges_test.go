@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// polls cond until it holds or a second has passed
+func eventually(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+
+	t.Fatal("condition not met within a second")
+}
+
+func TestParseRangeJSON(t *testing.T) {
+	var tests = []struct {
+		name    string
+		parse   RangeParser
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{"plain array", ParseRangeJSON, `["10.0.0.0/8", "2001:db8::1"]`, []string{"10.0.0.0/8", "2001:db8::1/128"}, false},
+		{"plain array with junk", ParseRangeJSON, `["10.0.0.0/8", "not a range"]`, nil, true},
+		{"object without selector", ParseRangeJSON, `{"ips": ["10.0.0.0/8"]}`, nil, true},
+		{
+			"cloudflare",
+			RangeJSONParser("result.ipv4_cidrs", "result.ipv6_cidrs"),
+			`{"result": {"ipv4_cidrs": ["173.245.48.0/20"], "ipv6_cidrs": ["2400:cb00::/32"], "etag": "1.2.3.4"}, "success": true}`,
+			[]string{"173.245.48.0/20", "2400:cb00::/32"},
+			false,
+		},
+		{
+			"aws",
+			RangeJSONParser("prefixes.ip_prefix"),
+			`{"syncToken": "1", "prefixes": [{"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2", "service": "127.0.0.1"}]}`,
+			[]string{"3.5.140.0/22"},
+			false,
+		},
+		{"ip shaped values elsewhere are ignored", RangeJSONParser("ips"), `{"ips": ["10.0.0.1"], "debug": {"client": "0.0.0.0/0"}}`, []string{"10.0.0.1/32"}, false},
+		{"missing path", RangeJSONParser("ips"), `{"addresses": ["10.0.0.1"]}`, nil, true},
+		{"object at selection", RangeJSONParser("ips"), `{"ips": {"a": "10.0.0.1"}}`, nil, true},
+		{"invalid json", ParseRangeJSON, `[`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, err := tt.parse([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want an error", prefixes)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(prefixes) != len(tt.want) {
+				t.Fatalf("got %v, want %v", prefixes, tt.want)
+			}
+
+			for i, p := range prefixes {
+				if p.String() != tt.want[i] {
+					t.Errorf("prefix %d = %s, want %s", i, p, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestURLRangesParserChoice(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		body        string
+		parse       RangeParser
+	}{
+		{"text", "text/plain; charset=utf-8", "# egress\n10.0.0.0/8\n\n", nil},
+		{"json", "application/json", `["10.0.0.0/8"]`, nil},
+		{"json suffix", "application/vnd.ranges+json", `["10.0.0.0/8"]`, nil},
+		{"custom parser wins", "text/plain", `{"result": {"ipv4_cidrs": ["10.0.0.0/8"]}}`, RangeJSONParser("result.ipv4_cidrs")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set(variables.HeaderContentType, tt.contentType)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+
+			u, err := NewURLRanges(ctx, &URLRangesConfig{URL: srv.URL, Parse: tt.parse, ErrorLogger: discardLogger})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !u.Contains(netip.MustParseAddr("10.1.2.3")) || u.Contains(netip.MustParseAddr("192.168.0.1")) {
+				t.Error("ranges were not loaded from the response")
+			}
+		})
+	}
+}
+
+func TestURLRangesErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		status  int
+		body    string
+		maxSize int64
+	}{
+		{"status", http.StatusServiceUnavailable, "10.0.0.0/8", 0},
+		{"too large", http.StatusOK, "10.0.0.0/8\n" + strings.Repeat("#", 64), 32},
+		{"unparsable", http.StatusOK, "10.0.0.0/33", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+
+			if _, err := NewURLRanges(ctx, &URLRangesConfig{URL: srv.URL, MaxSize: tt.maxSize, ErrorLogger: discardLogger}); err == nil {
+				t.Fatal("want an error")
+			}
+		})
+	}
+}
+
+func TestURLRangesRefresh(t *testing.T) {
+	var body atomic.Value
+	body.Store("10.0.0.0/8")
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body.Load().(string))
+	}))
+	defer srv.Close()
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	u, err := NewURLRanges(ctx, &URLRangesConfig{URL: srv.URL, Interval: 10 * time.Millisecond, ErrorLogger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a broken refresh keeps the previous ranges
+	body.Store("not a range")
+	time.Sleep(30 * time.Millisecond)
+
+	if !u.Contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Fatal("failed refresh dropped the previous ranges")
+	}
+
+	body.Store("192.168.0.0/16")
+	eventually(t, func() bool {
+		return u.Contains(netip.MustParseAddr("192.168.1.1")) && !u.Contains(netip.MustParseAddr("10.0.0.1"))
+	})
+}
+
+func TestFileRangesReload(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "ranges.txt")
+	if err := os.WriteFile(path, []byte("10.0.0.0/8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	f, err := NewFileRanges(ctx, &FileRangesConfig{Path: path, Interval: 10 * time.Millisecond, ErrorLogger: discardLogger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !f.Contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Fatal("initial ranges were not loaded")
+	}
+
+	// a different size so the change is seen even with a coarse modification time
+	if err := os.WriteFile(path, []byte("192.168.0.0/16\n2001:db8::/32\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	eventually(t, func() bool {
+		return f.Contains(netip.MustParseAddr("2001:db8::1")) && !f.Contains(netip.MustParseAddr("10.0.0.1"))
+	})
+
+	if err := os.WriteFile(path, []byte("invalid\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if !f.Contains(netip.MustParseAddr("192.168.1.1")) {
+		t.Error("failed reload dropped the previous ranges")
+	}
+}
+
+func TestNewFileRangesMissing(t *testing.T) {
+	if _, err := NewFileRanges(context.Background(), &FileRangesConfig{Path: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Fatal("want an error")
+	}
+}
@@ -0,0 +1,217 @@
+package respond
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+// how BlobConditional and JSONConditional compute an ETag when ConditionalConfig.ETag is empty
+type ETagMode int
+
+const (
+	// no ETag is computed
+	ETagNone ETagMode = iota
+	// a hash of the body, for bodies that are byte for byte identical
+	ETagStrong
+	// a hash of the body marked weak, for bodies that are semantically equivalent
+	ETagWeak
+)
+
+type ConditionalConfig struct {
+	// caller provided entity tag such as a version number, quoted if not already, takes precedence over Generate
+	ETag string
+	// computes an ETag from the body when ETag is empty
+	Generate ETagMode
+	// sent as Last-Modified and compared against If-Modified-Since and If-Unmodified-Since when not zero
+	LastModified time.Time
+}
+
+// quotes a bare entity tag, tags that are already quoted or weak are returned as is
+func formatETag(tag string) string {
+	if tag == "" || strings.HasPrefix(tag, `"`) || strings.HasPrefix(tag, `W/"`) {
+		return tag
+	}
+
+	return `"` + tag + `"`
+}
+
+// a strong or weak entity tag from the first 128 bits of the body's sha256 hash
+func hashETag(body []byte, weak bool) string {
+	var sum = sha256.Sum256(body)
+	var tag = `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	if weak {
+		return "W/" + tag
+	}
+
+	return tag
+}
+
+// evaluates the request's preconditions against the current representation in the order of RFC 9110 section 13.2.2
+//
+// exists reports whether the target currently has a representation, it decides what "*" matches,
+// so If-None-Match: * stops a request when it is true and If-Match: * stops one when it is false
+//
+// etag is the current entity tag including its quotes, and lastModified the current modification time,
+// either may be empty or zero when unknown
+//
+// returns http.StatusPreconditionFailed or http.StatusNotModified when the request should stop there, otherwise 0
+func CheckPreconditions(r *http.Request, exists bool, etag string, lastModified time.Time) int {
+	var lastModifiedKnown = !lastModified.IsZero()
+	lastModified = lastModified.Truncate(time.Second)
+
+	var getOrHead = r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if ifMatch := r.Header.Values(variables.HeaderIfMatch); len(ifMatch) > 0 {
+		if !matchETag(strings.Join(ifMatch, ","), exists, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if lastModifiedKnown {
+		if t, err := http.ParseTime(r.Header.Get(variables.HeaderIfUnmodifiedSince)); err == nil && lastModified.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := r.Header.Values(variables.HeaderIfNoneMatch); len(ifNoneMatch) > 0 {
+		if matchETag(strings.Join(ifNoneMatch, ","), exists, etag, true) {
+			if getOrHead {
+				return http.StatusNotModified
+			}
+
+			return http.StatusPreconditionFailed
+		}
+	} else if getOrHead && lastModifiedKnown {
+		if t, err := http.ParseTime(r.Header.Get(variables.HeaderIfModifiedSince)); err == nil && !lastModified.After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// reports whether the If-Match or If-None-Match header value matches etag,
+// "*" matches any current representation, with or without an entity tag
+func matchETag(header string, exists bool, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return exists
+	}
+
+	if etag == "" {
+		return false
+	}
+
+	for header != "" {
+		var tag string
+		tag, header = scanETag(header)
+		if tag == "" {
+			return false
+		}
+
+		if weak && weakETagMatch(tag, etag) || !weak && strongETagMatch(tag, etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns the first entity tag in a comma separated list and the remainder,
+// an empty tag if the list is malformed
+func scanETag(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t,")
+	if s == "" {
+		return "", ""
+	}
+
+	var start = 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+
+	if len(s) <= start || s[start] != '"' {
+		return "", ""
+	}
+
+	// etagc excludes the quote, so the next quote closes the tag
+	var end = strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", ""
+	}
+
+	end += start + 2
+
+	return s[:end], strings.TrimLeft(s[end:], " \t")
+}
+
+func strongETagMatch(a, b string) bool {
+	return a == b && !strings.HasPrefix(a, "W/")
+}
+
+func weakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// like Blob but answers conditional requests
+//
+// sets ETag and Last-Modified from c, computing the ETag from v if asked to
+//
+// responds with http.StatusNotModified or http.StatusPreconditionFailed when the request's preconditions say so,
+// preconditions are only evaluated when code is 2xx, v is then the current representation so "*" always matches
+func BlobConditional(w http.ResponseWriter, r *http.Request, mimeType string, v []byte, code int, c *ConditionalConfig) {
+	if c == nil {
+		c = &ConditionalConfig{}
+	}
+
+	var etag = formatETag(c.ETag)
+	if etag == "" && c.Generate != ETagNone {
+		etag = hashETag(v, c.Generate == ETagWeak)
+	}
+
+	if etag != "" {
+		w.Header().Set(variables.HeaderETag, etag)
+	}
+
+	if !c.LastModified.IsZero() {
+		w.Header().Set(variables.HeaderLastModified, c.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if code < 200 || code > 299 {
+		Blob(w, mimeType, v, code)
+		return
+	}
+
+	switch CheckPreconditions(r, true, etag, c.LastModified) {
+	case http.StatusNotModified:
+		w.Header().Del(variables.HeaderContentType)
+		w.Header().Del(variables.HeaderContentLength)
+		w.WriteHeader(http.StatusNotModified)
+	case http.StatusPreconditionFailed:
+		PlainText(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+	default:
+		Blob(w, mimeType, v, code)
+	}
+}
+
+// encodes v to a buffer and writes it with BlobConditional
+//
+// responds with http.StatusInternalServerError if encoding fails
+func JSONConditional(w http.ResponseWriter, r *http.Request, v any, code int, c *ConditionalConfig) error {
+	var buf = getBuffer(encodeSizes.get(variables.MIMEApplicationJSONCharsetUTF8))
+	defer putBuffer(buf)
+
+	if err := encodeJSON(buf, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	encodeSizes.observe(variables.MIMEApplicationJSONCharsetUTF8, buf.Len())
+
+	BlobConditional(w, r, variables.MIMEApplicationJSONCharsetUTF8, buf.Bytes(), code, c)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package respond
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	var modified = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var tests = []struct {
+		name    string
+		method  string
+		header  string
+		value   string
+		exists  bool
+		etag    string
+		lastMod time.Time
+		want    int
+	}{
+		{"if-match star exists without etag", http.MethodPut, variables.HeaderIfMatch, "*", true, "", time.Time{}, 0},
+		{"if-match star missing", http.MethodPut, variables.HeaderIfMatch, "*", false, "", time.Time{}, http.StatusPreconditionFailed},
+		{"if-match strong hit", http.MethodPut, variables.HeaderIfMatch, `"a", "b"`, true, `"b"`, time.Time{}, 0},
+		{"if-match weak never matches", http.MethodPut, variables.HeaderIfMatch, `W/"b"`, true, `W/"b"`, time.Time{}, http.StatusPreconditionFailed},
+		{"if-match no etag", http.MethodPut, variables.HeaderIfMatch, `"b"`, true, "", time.Time{}, http.StatusPreconditionFailed},
+		{"if-none-match star exists get", http.MethodGet, variables.HeaderIfNoneMatch, "*", true, "", time.Time{}, http.StatusNotModified},
+		{"if-none-match star exists put", http.MethodPut, variables.HeaderIfNoneMatch, "*", true, "", time.Time{}, http.StatusPreconditionFailed},
+		{"if-none-match star missing put", http.MethodPut, variables.HeaderIfNoneMatch, "*", false, "", time.Time{}, 0},
+		{"if-none-match weak hit", http.MethodGet, variables.HeaderIfNoneMatch, `W/"a"`, true, `"a"`, time.Time{}, http.StatusNotModified},
+		{"if-none-match miss", http.MethodGet, variables.HeaderIfNoneMatch, `"x"`, true, `"a"`, time.Time{}, 0},
+		{"if-modified-since not modified", http.MethodGet, variables.HeaderIfModifiedSince, modified.Format(http.TimeFormat), true, "", modified, http.StatusNotModified},
+		{"if-modified-since modified", http.MethodGet, variables.HeaderIfModifiedSince, modified.Add(-time.Second).Format(http.TimeFormat), true, "", modified, 0},
+		{"if-unmodified-since modified", http.MethodPut, variables.HeaderIfUnmodifiedSince, modified.Add(-time.Second).Format(http.TimeFormat), true, "", modified, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set(tt.header, tt.value)
+
+			if got := CheckPreconditions(r, tt.exists, tt.etag, tt.lastMod); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlobConditionalStarWithoutETag(t *testing.T) {
+	var tests = []struct {
+		method string
+		header string
+		want   int
+	}{
+		{http.MethodPut, variables.HeaderIfMatch, http.StatusOK},
+		{http.MethodGet, variables.HeaderIfNoneMatch, http.StatusNotModified},
+		{http.MethodPut, variables.HeaderIfNoneMatch, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		var r = httptest.NewRequest(tt.method, "/", nil)
+		r.Header.Set(tt.header, "*")
+
+		var w = httptest.NewRecorder()
+		BlobConditional(w, r, variables.MIMETextPlainCharsetUTF8, []byte("x"), http.StatusOK, nil)
+
+		if w.Code != tt.want {
+			t.Errorf("%s %s: *: got %d, want %d", tt.method, tt.header, w.Code, tt.want)
+		}
+	}
+}
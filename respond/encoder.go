@@ -0,0 +1,212 @@
+package respond
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/brody192/ext/variables"
+)
+
+// encodes values for a mime type, used by Encode and Negotiate
+type Encoder interface {
+	// the full content type header value, such as application/json; charset=UTF-8
+	ContentType() string
+	Encode(w io.Writer, v any) error
+}
+
+type funcEncoder struct {
+	contentType string
+	encode      func(w io.Writer, v any) error
+}
+
+func (e funcEncoder) ContentType() string {
+	return e.contentType
+}
+
+func (e funcEncoder) Encode(w io.Writer, v any) error {
+	return e.encode(w, v)
+}
+
+// adapts a streaming encode function to the Encoder interface
+func NewEncoder(contentType string, encode func(w io.Writer, v any) error) Encoder {
+	return funcEncoder{contentType: contentType, encode: encode}
+}
+
+// adapts a marshal function such as msgpack.Marshal or cbor.Marshal to the Encoder interface
+func MarshalEncoder(contentType string, marshal func(v any) ([]byte, error)) Encoder {
+	return NewEncoder(contentType, func(w io.Writer, v any) error {
+		b, err := marshal(v)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(b)
+		return err
+	})
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]Encoder{}
+	// registration order, used as the default offer order for Negotiate
+	encoderOrder []string
+)
+
+func init() {
+	RegisterEncoder(variables.MIMEApplicationJSON, NewEncoder(variables.MIMEApplicationJSONCharsetUTF8, encodeJSON))
+	RegisterEncoder(variables.MIMEApplicationXML, NewEncoder(variables.MIMEApplicationXMLCharsetUTF8, encodeXML))
+	RegisterEncoder(variables.MIMETextXML, NewEncoder(variables.MIMETextXMLCharsetUTF8, encodeXML))
+	RegisterEncoder(variables.MIMETextPlain, NewEncoder(variables.MIMETextPlainCharsetUTF8, encodeText))
+}
+
+// registers e for the given mime type, replacing any existing encoder for it
+//
+// JSON, XML and plain text are registered by default
+func RegisterEncoder(mimeType string, e Encoder) {
+	mimeType = normalizeMIME(mimeType)
+
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+
+	if _, ok := encoders[mimeType]; !ok {
+		encoderOrder = append(encoderOrder, mimeType)
+	}
+
+	encoders[mimeType] = e
+}
+
+// registers a msgpack marshal function such as msgpack.Marshal for variables.MIMEApplicationMsgpack
+func RegisterMsgpack(marshal func(v any) ([]byte, error)) {
+	RegisterEncoder(variables.MIMEApplicationMsgpack, MarshalEncoder(variables.MIMEApplicationMsgpack, marshal))
+}
+
+// registers a cbor marshal function such as cbor.Marshal for variables.MIMEApplicationCBOR
+func RegisterCBOR(marshal func(v any) ([]byte, error)) {
+	RegisterEncoder(variables.MIMEApplicationCBOR, MarshalEncoder(variables.MIMEApplicationCBOR, marshal))
+}
+
+// registers a protobuf marshal function for variables.MIMEApplicationProtobuf
+//
+//	respond.RegisterProtobuf(func(v any) ([]byte, error) {
+//		m, ok := v.(proto.Message)
+//		if !ok {
+//			return nil, fmt.Errorf("%T is not a proto.Message", v)
+//		}
+//		return proto.Marshal(m)
+//	})
+func RegisterProtobuf(marshal func(v any) ([]byte, error)) {
+	RegisterEncoder(variables.MIMEApplicationProtobuf, MarshalEncoder(variables.MIMEApplicationProtobuf, marshal))
+}
+
+// returns the encoder registered for the mime type, parameters such as charset are ignored
+func LookupEncoder(mimeType string) (Encoder, bool) {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	e, ok := encoders[normalizeMIME(mimeType)]
+	return e, ok
+}
+
+// returns the mime types with a registered encoder, in registration order
+func EncoderMIMETypes() []string {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+
+	return append([]string(nil), encoderOrder...)
+}
+
+func normalizeMIME(mimeType string) string {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		return mediaType
+	}
+
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
+
+// encodes v to a buffer with the encoder registered for mimeType
+//
+// sets content length of the buffer
+//
+// sets content type to the encoder's content type
+//
+// writes buffer to w
+//
+// returns ErrEncoderNotFound without writing anything if no encoder is registered for mimeType
+func Encode(w http.ResponseWriter, mimeType string, v any, code int) error {
+	var e, ok = LookupEncoder(mimeType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEncoderNotFound, mimeType)
+	}
+
+	return encodeWith(w, e, v, code)
+}
+
+// encodes v to a buffer, responds with http.StatusInternalServerError if encoding fails
+func encodeWith(w http.ResponseWriter, e Encoder, v any, code int) error {
+	var contentType = e.ContentType()
+
+	var buf = getBuffer(encodeSizes.get(contentType))
+	defer putBuffer(buf)
+
+	if err := e.Encode(buf, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+
+	encodeSizes.observe(contentType, buf.Len())
+
+	Blob(w, contentType, buf.Bytes(), code)
+
+	return nil
+}
+
+type jsonEncoder struct {
+	indent string
+}
+
+func (e jsonEncoder) ContentType() string {
+	return variables.MIMEApplicationJSONCharsetUTF8
+}
+
+func (e jsonEncoder) Encode(w io.Writer, v any) error {
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", e.indent)
+	enc.SetEscapeHTML(true)
+	return enc.Encode(v)
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	return jsonEncoder{}.Encode(w, v)
+}
+
+func encodeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// strings, byte slices, errors and fmt.Stringer values are written as is, anything else is formatted with %v
+func encodeText(w io.Writer, v any) error {
+	var err error
+
+	switch v := v.(type) {
+	case string:
+		_, err = io.WriteString(w, v)
+	case []byte:
+		_, err = w.Write(v)
+	case error:
+		_, err = io.WriteString(w, v.Error())
+	default:
+		_, err = fmt.Fprint(w, v)
+	}
+
+	return err
+}
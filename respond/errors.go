@@ -4,3 +4,15 @@ import "errors"
 
 // template not found error
 var ErrTemplateNotFound = errors.New("template not found")
+
+// no offered content type is acceptable to the client
+var ErrNotAcceptable = errors.New("not acceptable")
+
+// no encoder is registered for the mime type
+var ErrEncoderNotFound = errors.New("encoder not found")
+
+// an event field that can't be written to an event stream, such as an id containing a newline
+var ErrInvalidEvent = errors.New("invalid event")
+
+// redirect target is on a host that isn't allowed or uses a scheme other than http or https
+var ErrUnsafeRedirect = errors.New("unsafe redirect")
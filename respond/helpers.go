@@ -0,0 +1,180 @@
+package respond
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/brody192/ext/set"
+	"github.com/brody192/ext/utilities"
+	"github.com/brody192/ext/variables"
+)
+
+// redirects to target with the given 3xx code
+//
+// relative targets are sanitized with utilities.SanitizeURI so `//host` and `\\host` stay on this host
+//
+// absolute targets must use http or https and point at the request's host or one of allowedHosts,
+// entries like *.example.com match any subdomain
+//
+// returns ErrUnsafeRedirect without writing anything if the target isn't allowed
+func Redirect(w http.ResponseWriter, r *http.Request, target string, code int, allowedHosts ...string) error {
+	var sanitized = utilities.SanitizeURI(target)
+
+	u, err := url.Parse(sanitized)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnsafeRedirect, err)
+	}
+
+	if u.Scheme != "" || u.Host != "" {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("%w: scheme %q", ErrUnsafeRedirect, u.Scheme)
+		}
+
+		if !redirectHostAllowed(u.Hostname(), r, allowedHosts) {
+			return fmt.Errorf("%w: host %q", ErrUnsafeRedirect, u.Hostname())
+		}
+	}
+
+	http.Redirect(w, r, sanitized, code)
+
+	return nil
+}
+
+func redirectHostAllowed(host string, r *http.Request, allowedHosts []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+
+	var requestHost = r.Host
+	if h, _, err := net.SplitHostPort(requestHost); err == nil {
+		requestHost = h
+	}
+
+	if strings.EqualFold(host, strings.Trim(requestHost, "[]")) {
+		return true
+	}
+
+	for _, allowed := range allowedHosts {
+		allowed = strings.ToLower(allowed)
+
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+
+			continue
+		}
+
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responds with http.StatusNoContent
+func NoContent(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sets location header to location
+//
+// encodes v as json with http.StatusCreated, or writes only the status if v is nil
+func Created(w http.ResponseWriter, location string, v any) {
+	w.Header().Set(variables.HeaderLocation, location)
+
+	if v == nil {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	JSON(w, v, http.StatusCreated)
+}
+
+// serves name from fsys
+//
+// sets content type from the extension, or from the content when the extension is unknown, unless already set
+//
+// files that can seek are served with http.ServeContent for Range, If-Range and If-Modified-Since support
+//
+// returns the error from opening the file so callers can respond with http.StatusNotFound for fs.ErrNotExist
+func File(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) error {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if w.Header().Get(variables.HeaderContentType) == "" {
+		if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+			w.Header().Set(variables.HeaderContentType, ct)
+		}
+	}
+
+	var c = &StreamConfig{Name: name, ModTime: info.ModTime(), Size: info.Size()}
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return StreamWith(w, r, rs, http.StatusOK, c)
+	}
+
+	var re io.Reader = f
+
+	if w.Header().Get(variables.HeaderContentType) == "" {
+		var head = make([]byte, 512)
+
+		n, err := io.ReadFull(f, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		w.Header().Set(variables.HeaderContentType, http.DetectContentType(head[:n]))
+		re = io.MultiReader(bytes.NewReader(head[:n]), f)
+	}
+
+	return StreamWith(w, r, re, http.StatusOK, c)
+}
+
+// serves name from fsys like File as a download
+//
+// sets content disposition to attachment with filename, or the base name of name when filename is empty
+func Attachment(w http.ResponseWriter, r *http.Request, fsys fs.FS, name, filename string) error {
+	if filename == "" {
+		filename = path.Base(name)
+	}
+
+	set.AttachmentFilename(w, filename)
+
+	var err = File(w, r, fsys, name)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		// nothing was written, don't leave the disposition on the caller's error response
+		w.Header().Del(variables.HeaderContentDisposition)
+	}
+
+	return err
+}
@@ -0,0 +1,68 @@
+package respond
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestRedirect(t *testing.T) {
+	var tests = []struct {
+		name     string
+		target   string
+		allowed  []string
+		location string
+	}{
+		{"relative", "/login?next=%2F", nil, "/login?next=%2F"},
+		{"protocol relative", "//evil.com", nil, "/evil.com"},
+		{"protocol relative backslashes", `\\evil.com`, nil, "/evil.com"},
+		{"slash backslash", `/\evil.com`, nil, "/evil.com"},
+		{"request host", "https://good.com/home", nil, "https://good.com/home"},
+		{"request host any case", "https://GOOD.com./home", nil, "https://GOOD.com./home"},
+		{"allowed host", "https://accounts.example/", []string{"accounts.example"}, "https://accounts.example/"},
+		{"wildcard subdomain", "https://app.trusted.com/", []string{"*.trusted.com"}, "https://app.trusted.com/"},
+		{"wildcard nested subdomain", "https://a.b.trusted.com/", []string{"*.trusted.com"}, "https://a.b.trusted.com/"},
+		{"other host", "https://evil.com/", nil, ""},
+		{"scheme without slashes", "https:evil.com", nil, ""},
+		{"userinfo", "https://good.com@evil.com/", nil, ""},
+		{"host suffix", "https://good.com.evil.com/", nil, ""},
+		{"wildcard is not the apex", "https://trusted.com/", []string{"*.trusted.com"}, ""},
+		{"wildcard suffix without dot", "https://eviltrusted.com/", []string{"*.trusted.com"}, ""},
+		{"javascript", "javascript:alert(1)", nil, ""},
+		{"javascript any case", "JavaScript:alert(1)", nil, ""},
+		{"data", "data:text/html,<script>alert(1)</script>", nil, ""},
+		{"ftp", "ftp://good.com/", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = httptest.NewRequest(http.MethodGet, "http://good.com/page", nil)
+			var w = httptest.NewRecorder()
+
+			var err = Redirect(w, r, tt.target, http.StatusFound, tt.allowed...)
+
+			if tt.location == "" {
+				if !errors.Is(err, ErrUnsafeRedirect) {
+					t.Fatalf("err = %v, want ErrUnsafeRedirect", err)
+				}
+
+				if w.Header().Get(variables.HeaderLocation) != "" || w.Code != http.StatusOK {
+					t.Errorf("rejected redirect wrote %d %q", w.Code, w.Header().Get(variables.HeaderLocation))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != http.StatusFound || w.Header().Get(variables.HeaderLocation) != tt.location {
+				t.Errorf("got %d %q, want 302 %q", w.Code, w.Header().Get(variables.HeaderLocation), tt.location)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package respond
+
+import (
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+// the shape JSONStream writes items in
+type JSONStreamFormat int
+
+const (
+	// a single JSON array, application/json
+	JSONArray JSONStreamFormat = iota
+	// one JSON value per line, application/x-ndjson
+	NDJSON
+)
+
+type JSONStreamConfig struct {
+	// defaults to JSONArray
+	Format JSONStreamFormat
+	// longest time an encoded item may sit in the response buffer, defaults to one second,
+	// flushed by a timer even while waiting for the next item, a negative value flushes after every item
+	FlushInterval time.Duration
+}
+
+func (c *JSONStreamConfig) loadDefaults() {
+	if c.FlushInterval == 0 {
+		c.FlushInterval = time.Second
+	}
+}
+
+// encodes each item of seq straight to w without buffering the whole collection
+//
+// sets content type to application json or application x-ndjson depending on the format
+//
+// stops when the request context is cancelled, an item fails to encode or a write fails, and returns that error
+//
+// a failed stream is reported in the X-Stream-Error trailer, NDJSON streams also end with a final
+// {"error": "..."} line and JSON arrays are left unterminated so clients can't mistake them for complete
+func JSONStream[T any](w http.ResponseWriter, r *http.Request, seq iter.Seq[T], code int, c *JSONStreamConfig) error {
+	if c == nil {
+		c = &JSONStreamConfig{}
+	}
+
+	c.loadDefaults()
+
+	var ctx = r.Context()
+
+	var h = w.Header()
+	h.Del(variables.HeaderContentLength)
+	h.Add(variables.HeaderTrailer, variables.HeaderXStreamError)
+
+	if c.Format == NDJSON {
+		h.Set(variables.HeaderContentType, variables.MIMEApplicationNDJSON)
+	} else {
+		h.Set(variables.HeaderContentType, variables.MIMEApplicationJSONCharsetUTF8)
+	}
+
+	w.WriteHeader(code)
+
+	var lw = newLatencyWriter(w, c.FlushInterval)
+	var enc = json.NewEncoder(lw)
+
+	var err = func() error {
+		if c.Format == JSONArray {
+			if _, err := io.WriteString(lw, "["); err != nil {
+				return err
+			}
+		}
+
+		var first = true
+
+		for item := range seq {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if c.Format == JSONArray && !first {
+				if _, err := io.WriteString(lw, ","); err != nil {
+					return err
+				}
+			}
+
+			first = false
+
+			if c.Format == NDJSON {
+				if err := enc.Encode(item); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			// the encoder ends every value with a newline, array items are marshalled so they're separated by commas only
+			b, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+
+			if _, err := lw.Write(b); err != nil {
+				return err
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if c.Format == JSONArray {
+			if _, err := io.WriteString(lw, "]\n"); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}()
+
+	if err != nil {
+		h.Set(variables.HeaderXStreamError, strings.Join(strings.Fields(err.Error()), " "))
+
+		// a cancelled request has no one left to read the sentinel
+		if c.Format == NDJSON && ctx.Err() == nil {
+			enc.Encode(map[string]string{"error": err.Error()})
+		}
+
+		lw.stop()
+
+		return err
+	}
+
+	return lw.stop()
+}
+
+// like JSONStream but reads items from ch until it is closed
+func JSONStreamChan[T any](w http.ResponseWriter, r *http.Request, ch <-chan T, code int, c *JSONStreamConfig) error {
+	var ctx = r.Context()
+
+	return JSONStream(w, r, func(yield func(T) bool) {
+		for {
+			select {
+			case item, ok := <-ch:
+				if !ok || !yield(item) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}, code, c)
+}
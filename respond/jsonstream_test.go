@@ -0,0 +1,98 @@
+package respond
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestJSONStreamFormats(t *testing.T) {
+	var tests = []struct {
+		format JSONStreamFormat
+		mime   string
+		want   string
+	}{
+		{JSONArray, variables.MIMEApplicationJSONCharsetUTF8, "[1,2,3]\n"},
+		{NDJSON, variables.MIMEApplicationNDJSON, "1\n2\n3\n"},
+	}
+
+	for _, tt := range tests {
+		var r = httptest.NewRequest(http.MethodGet, "/", nil)
+		var w = httptest.NewRecorder()
+
+		if err := JSONStream(w, r, slices.Values([]int{1, 2, 3}), http.StatusOK, &JSONStreamConfig{Format: tt.format}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := w.Header().Get(variables.HeaderContentType); got != tt.mime {
+			t.Errorf("content type = %q, want %q", got, tt.mime)
+		}
+
+		if w.Body.String() != tt.want {
+			t.Errorf("body = %q, want %q", w.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestJSONStreamCancelled(t *testing.T) {
+	var ctx, cancel = context.WithCancel(context.Background())
+	var r = httptest.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+	var w = httptest.NewRecorder()
+
+	var err = JSONStream(w, r, func(yield func(int) bool) {
+		yield(1)
+		cancel()
+		yield(2)
+	}, http.StatusOK, &JSONStreamConfig{Format: NDJSON})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+
+	if w.Body.String() != "1\n" {
+		t.Errorf("body = %q, want only the first item", w.Body.String())
+	}
+}
+
+// an item sent before the channel goes quiet must reach the client within the flush interval
+func TestJSONStreamChanFlushesWhileIdle(t *testing.T) {
+	var ch = make(chan int)
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		JSONStreamChan(w, r, ch, http.StatusOK, &JSONStreamConfig{Format: NDJSON, FlushInterval: 20 * time.Millisecond})
+	}))
+	defer srv.Close()
+	// unblocks the handler before the server waits for it
+	defer close(ch)
+
+	// the headers are only flushed along with the first item
+	go func() { ch <- 1 }()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var got = make(chan string, 1)
+	go func() {
+		var line, _ = bufio.NewReader(resp.Body).ReadString('\n')
+		got <- line
+	}()
+
+	select {
+	case line := <-got:
+		if line != "1\n" {
+			t.Errorf("got %q, want 1", line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("item was not flushed while the channel was idle")
+	}
+}
@@ -0,0 +1,178 @@
+package respond
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brody192/ext/variables"
+)
+
+type negotiateConfig struct {
+	offers       []string
+	template     *template.Template
+	templateName string
+}
+
+type NegotiateOption func(*negotiateConfig)
+
+// restricts the mime types Negotiate may respond with, in order of preference, defaults to every registered encoder
+//
+// types without a registered encoder, or text/html without WithTemplate, are never chosen
+func Offer(mimeTypes ...string) NegotiateOption {
+	return func(c *negotiateConfig) {
+		c.offers = mimeTypes
+	}
+}
+
+// offers text/html by executing the named template in t with v as its data, used instead of the text/html encoder
+func WithTemplate(t *template.Template, name string) NegotiateOption {
+	return func(c *negotiateConfig) {
+		c.template = t
+		c.templateName = name
+	}
+}
+
+// encodes v to a buffer with the registered encoder that best matches the request's Accept header
+//
+// sets Vary to Accept
+//
+// responds with http.StatusNotAcceptable and returns ErrNotAcceptable if none of the offered types that can be encoded
+// are acceptable
+//
+// returns ErrTemplateNotFound if text/html was chosen and the template does not exist
+func Negotiate(w http.ResponseWriter, r *http.Request, v any, code int, opts ...NegotiateOption) error {
+	var c = &negotiateConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	var offers = EncoderMIMETypes()
+	if len(c.offers) > 0 {
+		offers = c.filterOffers()
+	} else if c.template != nil {
+		// after json so clients that accept anything get json, browsers ask for html explicitly
+		offers = append([]string{offers[0], variables.MIMETextHTML}, offers[1:]...)
+	}
+
+	w.Header().Add(variables.HeaderVary, variables.HeaderAccept)
+
+	var chosen = NegotiateContentType(r, offers)
+	if chosen == "" {
+		PlainText(w, http.StatusText(http.StatusNotAcceptable)+"\navailable: "+strings.Join(offers, ", ")+"\n", http.StatusNotAcceptable)
+		return fmt.Errorf("%w: %s", ErrNotAcceptable, r.Header.Get(variables.HeaderAccept))
+	}
+
+	if c.template != nil && normalizeMIME(chosen) == variables.MIMETextHTML {
+		return Template(w, c.template, c.templateName, v, code)
+	}
+
+	return Encode(w, chosen, v, code)
+}
+
+// returns the offers Negotiate can respond with, so a chosen type is always encoded
+func (c *negotiateConfig) filterOffers() []string {
+	var offers = make([]string, 0, len(c.offers))
+
+	for _, offer := range c.offers {
+		if _, ok := LookupEncoder(offer); ok || c.template != nil && normalizeMIME(offer) == variables.MIMETextHTML {
+			offers = append(offers, offer)
+		}
+	}
+
+	return offers
+}
+
+// a media range from an Accept header
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// parses an Accept header into its media ranges, invalid ranges are skipped
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+
+	for _, part := range strings.Split(header, ",") {
+		var mediaRange, params, _ = strings.Cut(part, ";")
+
+		var typ, subtype, ok = strings.Cut(strings.ToLower(strings.TrimSpace(mediaRange)), "/")
+		if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+			continue
+		}
+
+		var ar = acceptRange{typ: typ, subtype: subtype, q: 1}
+
+		for _, param := range strings.Split(params, ";") {
+			var key, value, _ = strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(key)) != "q" {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && q >= 0 && q <= 1 {
+				ar.q = q
+			}
+		}
+
+		ranges = append(ranges, ar)
+	}
+
+	return ranges
+}
+
+// returns the offer the request's Accept header prefers, empty if none are acceptable
+//
+// the most specific matching media range decides an offer's q-value, ties go to the earlier offer,
+// a missing Accept header accepts the first offer
+func NegotiateContentType(r *http.Request, offers []string) string {
+	var header = strings.Join(r.Header.Values(variables.HeaderAccept), ",")
+	if strings.TrimSpace(header) == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+
+		return ""
+	}
+
+	var ranges = parseAccept(header)
+
+	var best string
+	var bestQ float64
+
+	for _, offer := range offers {
+		var typ, subtype, _ = strings.Cut(strings.ToLower(offer), "/")
+
+		var q float64
+		var specificity = -1
+
+		for _, ar := range ranges {
+			var s int
+
+			switch {
+			case ar.typ == typ && ar.subtype == subtype:
+				s = 2
+			case ar.typ == typ && ar.subtype == "*":
+				s = 1
+			case ar.typ == "*":
+				s = 0
+			default:
+				continue
+			}
+
+			if s > specificity {
+				specificity = s
+				q = ar.q
+			}
+		}
+
+		if q > bestQ {
+			best = offer
+			bestQ = q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,75 @@
+package respond
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	var offers = []string{variables.MIMEApplicationJSON, variables.MIMEApplicationXML, variables.MIMETextHTML}
+
+	var tests = []struct {
+		accept string
+		want   string
+	}{
+		{"", variables.MIMEApplicationJSON},
+		{"*/*", variables.MIMEApplicationJSON},
+		{"application/xml", variables.MIMEApplicationXML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", variables.MIMETextHTML},
+		{"application/*;q=0.5, application/xml", variables.MIMEApplicationXML},
+		{"text/*;q=0.5, */*;q=0.1", variables.MIMETextHTML},
+		{"application/json;q=0, */*", variables.MIMEApplicationXML},
+		{"image/png", ""},
+	}
+
+	for _, tt := range tests {
+		var r = httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.accept != "" {
+			r.Header.Set(variables.HeaderAccept, tt.accept)
+		}
+
+		if got := NegotiateContentType(r, offers); got != tt.want {
+			t.Errorf("Accept %q: got %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateSkipsOffersWithoutEncoder(t *testing.T) {
+	var tmpl = template.Must(template.New("page").Parse(`<p>{{.}}</p>`))
+
+	var tests = []struct {
+		name     string
+		accept   string
+		opts     []NegotiateOption
+		wantCode int
+		wantType string
+	}{
+		{"html without template", "text/html, application/json;q=0.5", []NegotiateOption{Offer(variables.MIMETextHTML, variables.MIMEApplicationJSON)}, http.StatusOK, variables.MIMEApplicationJSONCharsetUTF8},
+		{"only html without template", "text/html", []NegotiateOption{Offer(variables.MIMETextHTML)}, http.StatusNotAcceptable, variables.MIMETextPlainCharsetUTF8},
+		{"unregistered type", "*/*", []NegotiateOption{Offer("application/x-unknown", variables.MIMEApplicationXML)}, http.StatusOK, variables.MIMEApplicationXMLCharsetUTF8},
+		{"html with template", "text/html", []NegotiateOption{Offer(variables.MIMETextHTML), WithTemplate(tmpl, "page")}, http.StatusOK, variables.MIMETextHTMLCharsetUTF8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(variables.HeaderAccept, tt.accept)
+
+			var w = httptest.NewRecorder()
+			var err = Negotiate(w, r, "hi", http.StatusOK, tt.opts...)
+
+			if tt.wantCode == http.StatusNotAcceptable && !errors.Is(err, ErrNotAcceptable) {
+				t.Errorf("err = %v, want ErrNotAcceptable", err)
+			}
+
+			if w.Code != tt.wantCode || w.Header().Get(variables.HeaderContentType) != tt.wantType {
+				t.Errorf("got %d %q, want %d %q", w.Code, w.Header().Get(variables.HeaderContentType), tt.wantCode, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package respond
+
+import (
+	"bytes"
+	"sync"
+	"sync/atomic"
+)
+
+// capacities of the pooled buffer classes, buffers that grow past the largest class are left to the garbage collector
+var bufferClasses = [...]int{4 << 10, 64 << 10, 1 << 20}
+
+var bufferPools [len(bufferClasses)]sync.Pool
+
+// returns an empty buffer from the smallest class that fits sizeHint
+//
+// only that class's pool is used so a small response never holds on to a large buffer,
+// hints past the largest class get a fresh buffer of that size
+//
+// buffers must be returned with putBuffer once nothing references their bytes
+func getBuffer(sizeHint int) *bytes.Buffer {
+	for i, size := range bufferClasses {
+		if size < sizeHint {
+			continue
+		}
+
+		if buf, ok := bufferPools[i].Get().(*bytes.Buffer); ok {
+			return buf
+		}
+
+		return bytes.NewBuffer(make([]byte, 0, size))
+	}
+
+	return bytes.NewBuffer(make([]byte, 0, sizeHint))
+}
+
+// resets buf and pools it in the largest class its capacity covers
+//
+// buffers that grew well past the largest class are dropped so one huge response doesn't pin its memory,
+// buffers smaller than the smallest class are dropped too
+func putBuffer(buf *bytes.Buffer) {
+	var c = buf.Cap()
+	if c > bufferClasses[len(bufferClasses)-1]*2 {
+		return
+	}
+
+	for i := len(bufferClasses) - 1; i >= 0; i-- {
+		if c >= bufferClasses[i] {
+			buf.Reset()
+			bufferPools[i].Put(buf)
+			return
+		}
+	}
+}
+
+// the size of the last response buffered for each key, such as a content type or template name,
+// used as the size hint for the next response with that key since the size isn't known before encoding
+type sizeHints struct {
+	mu    sync.RWMutex
+	sizes map[string]*atomic.Int64
+}
+
+// returns the last size observed for key, 0 if there is none
+func (h *sizeHints) get(key string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if n, ok := h.sizes[key]; ok {
+		return int(n.Load())
+	}
+
+	return 0
+}
+
+// records the size of a response buffered for key
+func (h *sizeHints) observe(key string, size int) {
+	h.mu.RLock()
+	var n, ok = h.sizes[key]
+	h.mu.RUnlock()
+
+	if !ok {
+		h.mu.Lock()
+		if n, ok = h.sizes[key]; !ok {
+			if h.sizes == nil {
+				h.sizes = map[string]*atomic.Int64{}
+			}
+
+			n = new(atomic.Int64)
+			h.sizes[key] = n
+		}
+		h.mu.Unlock()
+	}
+
+	n.Store(int64(size))
+}
+
+// size hints keyed by content type for encoded responses, and by template name for RenderTemplate
+var (
+	encodeSizes   sizeHints
+	templateSizes sizeHints
+)
@@ -0,0 +1,200 @@
+package respond
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+// a ResponseWriter that discards the body, like net/http's it implements io.StringWriter
+type discardWriter struct {
+	header http.Header
+}
+
+func newDiscardWriter() *discardWriter {
+	return &discardWriter{header: http.Header{}}
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *discardWriter) WriteString(s string) (int, error) {
+	return len(s), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+type benchItem struct {
+	ID    int      `json:"id" xml:"id"`
+	Name  string   `json:"name" xml:"name"`
+	Tags  []string `json:"tags" xml:"tags"`
+	Score float64  `json:"score" xml:"score"`
+}
+
+func benchItems(n int) []benchItem {
+	var items = make([]benchItem, n)
+	for i := range items {
+		items[i] = benchItem{ID: i, Name: "item", Tags: []string{"a", "b"}, Score: 1.5}
+	}
+
+	return items
+}
+
+func TestGetBufferClasses(t *testing.T) {
+	var tests = []struct {
+		hint    int
+		wantCap int
+	}{
+		{0, bufferClasses[0]},
+		{bufferClasses[0], bufferClasses[0]},
+		{bufferClasses[0] + 1, bufferClasses[1]},
+		{bufferClasses[2] + 1, bufferClasses[2] + 1},
+	}
+
+	for _, tt := range tests {
+		var buf = getBuffer(tt.hint)
+
+		if buf.Len() != 0 {
+			t.Errorf("getBuffer(%d) is not empty", tt.hint)
+		}
+
+		if buf.Cap() < tt.wantCap {
+			t.Errorf("getBuffer(%d) cap = %d, want at least %d", tt.hint, buf.Cap(), tt.wantCap)
+		}
+	}
+}
+
+func TestGetBufferKeepsLargeBuffersForLargeHints(t *testing.T) {
+	var large = bytes.NewBuffer(make([]byte, 0, bufferClasses[2]))
+	putBuffer(large)
+
+	if buf := getBuffer(0); buf.Cap() >= bufferClasses[1] {
+		t.Errorf("getBuffer(0) took a pooled buffer with cap %d", buf.Cap())
+	}
+}
+
+func TestSizeHints(t *testing.T) {
+	var h sizeHints
+
+	if got := h.get("a"); got != 0 {
+		t.Errorf("unseen key = %d, want 0", got)
+	}
+
+	h.observe("a", 100)
+	h.observe("b", 5000)
+	h.observe("a", 200)
+
+	if got := h.get("a"); got != 200 {
+		t.Errorf("a = %d, want the last size 200", got)
+	}
+
+	if got := h.get("b"); got != 5000 {
+		t.Errorf("b = %d, want 5000", got)
+	}
+}
+
+func TestPutBufferDropsOversized(t *testing.T) {
+	var buf = bytes.NewBuffer(make([]byte, 0, bufferClasses[len(bufferClasses)-1]*2+1))
+	buf.WriteString("x")
+
+	putBuffer(buf)
+
+	// the buffer was dropped rather than reset and pooled
+	if buf.Len() != 1 {
+		t.Fatal("oversized buffer was pooled")
+	}
+}
+
+func TestPooledBuffersDontLeakBetweenResponses(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		var w = newRecorder()
+		JSON(w, map[string]int{"n": i}, http.StatusOK)
+
+		var want = `{"n":` + string(rune('0'+i)) + "}\n"
+		if w.body.String() != want {
+			t.Fatalf("body = %q, want %q", w.body.String(), want)
+		}
+
+		if w.header.Get(variables.HeaderContentLength) != "8" {
+			t.Fatalf("content length = %s", w.header.Get(variables.HeaderContentLength))
+		}
+	}
+}
+
+type recorder struct {
+	discardWriter
+	body bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{discardWriter: discardWriter{header: http.Header{}}}
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *recorder) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func BenchmarkJSON(b *testing.B) {
+	var w = newDiscardWriter()
+	var v = benchItems(100)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		JSON(w, v, http.StatusOK)
+	}
+}
+
+func BenchmarkTemplate(b *testing.B) {
+	var w = newDiscardWriter()
+	var t = template.Must(template.New("page").Parse(`<ul>{{range .}}<li>{{.ID}} {{.Name}}</li>{{end}}</ul>`))
+	var v = benchItems(100)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := Template(w, t, "page", v, http.StatusOK); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPlainText(b *testing.B) {
+	var w = newDiscardWriter()
+	var v = strings.Repeat("hello world\n", 100)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		PlainText(w, v, http.StatusOK)
+	}
+}
+
+func BenchmarkEncodeXML(b *testing.B) {
+	var w = newDiscardWriter()
+	var v = benchItems(100)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := Encode(w, variables.MIMEApplicationXML, v, http.StatusOK); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+var _ io.StringWriter = (*discardWriter)(nil)
@@ -0,0 +1,302 @@
+package respond
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brody192/ext/utilities"
+	"github.com/brody192/ext/variables"
+)
+
+// RFC 9457 problem details, rendered by WriteProblem as application/problem+json or application/problem+xml
+//
+// Problem implements error so it can be returned and wrapped like any other error
+type Problem struct {
+	// uri identifying the problem type, about:blank when empty
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// extension members rendered alongside the standard members, standard members take precedence
+	Extensions map[string]any
+
+	err error
+}
+
+// creates a problem with the status text as its title
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	var msg = p.Title
+	if msg == "" {
+		msg = http.StatusText(p.Status)
+	}
+
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+
+	return msg
+}
+
+// returns the error the problem was created from, if any
+func (p *Problem) Unwrap() error {
+	return p.err
+}
+
+// sets an extension member and returns p
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any, 1)
+	}
+
+	p.Extensions[key] = value
+
+	return p
+}
+
+// sets the error returned by Unwrap and returns p, the error is never rendered
+func (p *Problem) Wrap(err error) *Problem {
+	p.err = err
+	return p
+}
+
+func (p *Problem) members() map[string]any {
+	var m = make(map[string]any, len(p.Extensions)+5)
+
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+
+	for k, v := range map[string]string{"type": p.Type, "title": p.Title, "detail": p.Detail, "instance": p.Instance} {
+		if v != "" {
+			m[k] = v
+		} else {
+			delete(m, k)
+		}
+	}
+
+	if p.Status != 0 {
+		m["status"] = p.Status
+	} else {
+		delete(m, "status")
+	}
+
+	return m
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.members())
+}
+
+// renders the problem in the RFC 9457 XML format, arrays are written as repeated i elements
+func (p *Problem) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	var start = xml.StartElement{Name: xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"}}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if err := encodeProblemXMLMembers(e, p.members()); err != nil {
+		return err
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+func encodeProblemXMLMembers(e *xml.Encoder, m map[string]any) error {
+	var keys = make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := encodeProblemXMLValue(e, k, m[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maps of any key and value type are written as nested elements and slices and arrays as repeated i elements,
+// everything else is left to encoding/xml
+func encodeProblemXMLValue(e *xml.Encoder, name string, v any) error {
+	var start = xml.StartElement{Name: xml.Name{Local: name}}
+
+	var rv = reflect.ValueOf(v)
+	for (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Map:
+		var m = make(map[string]any, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			m[fmt.Sprint(it.Key().Interface())] = it.Value().Interface()
+		}
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+
+		if err := encodeProblemXMLMembers(e, m); err != nil {
+			return err
+		}
+
+		return e.EncodeToken(start.End())
+	case reflect.Slice, reflect.Array:
+		// byte slices are text, as encoding/xml writes them
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeProblemXMLValue(e, "i", rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+
+		return e.EncodeToken(start.End())
+	}
+
+	return e.EncodeElement(v, start)
+}
+
+// converts an error to a problem, return nil to let the next mapper try
+type ProblemMapper func(err error) *Problem
+
+// implemented by errors that know how to describe themselves as a problem
+type ProblemProvider interface {
+	Problem() *Problem
+}
+
+var (
+	problemMappersMu sync.RWMutex
+	problemMappers   []ProblemMapper
+)
+
+// registers a mapper used by ProblemFromError, mappers run in registration order
+func RegisterProblemMapper(m ProblemMapper) {
+	problemMappersMu.Lock()
+	problemMappers = append(problemMappers, m)
+	problemMappersMu.Unlock()
+}
+
+// converts err to a problem
+//
+// a *Problem or ProblemProvider found with errors.As is used first, then the registered mappers,
+// otherwise a problem with the given status is created, err's message is only used as the detail for 4xx statuses
+func ProblemFromError(err error, status int) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		var cp = *p
+		return &cp
+	}
+
+	var provider ProblemProvider
+	if errors.As(err, &provider) {
+		if p = provider.Problem(); p != nil {
+			return p.Wrap(err)
+		}
+	}
+
+	problemMappersMu.RLock()
+	var mappers = problemMappers
+	problemMappersMu.RUnlock()
+
+	for _, m := range mappers {
+		if p = m(err); p != nil {
+			return p.Wrap(err)
+		}
+	}
+
+	p = NewProblem(status, "")
+	if status < 500 && err != nil {
+		p.Detail = err.Error()
+	}
+
+	return p.Wrap(err)
+}
+
+// the types clients may ask for, xml variants render problem+xml and everything else problem+json
+var problemOffers = []string{
+	variables.MIMEApplicationProblemJSON,
+	variables.MIMEApplicationProblemXML,
+	variables.MIMEApplicationJSON,
+	variables.MIMEApplicationXML,
+	variables.MIMETextXML,
+}
+
+// writes p as application/problem+xml if the request prefers xml, application/problem+json otherwise
+// or when p can't be encoded as xml
+//
+// sets Vary to Accept
+//
+// the request id is added as the request_id extension member when the request carries one
+//
+// status defaults to http.StatusInternalServerError when p has none
+func WriteProblem(w http.ResponseWriter, r *http.Request, p *Problem) error {
+	var cp = *p
+
+	if cp.Status == 0 {
+		cp.Status = http.StatusInternalServerError
+	}
+
+	if id := utilities.GetRequestID(r.Context()); id != "" {
+		if _, ok := cp.Extensions["request_id"]; !ok {
+			cp.Extensions = make(map[string]any, len(p.Extensions)+1)
+			for k, v := range p.Extensions {
+				cp.Extensions[k] = v
+			}
+
+			cp.Extensions["request_id"] = id
+		}
+	}
+
+	w.Header().Add(variables.HeaderVary, variables.HeaderAccept)
+
+	if strings.HasSuffix(NegotiateContentType(r, problemOffers), "xml") {
+		// problem documents are small, the smallest class fits them
+		var buf = getBuffer(0)
+		defer putBuffer(buf)
+
+		// extension members encoding/xml can't represent, such as structs holding maps, still render as json
+		if err := encodeXML(buf, &cp); err == nil {
+			Blob(w, variables.MIMEApplicationProblemXML, buf.Bytes(), cp.Status)
+			return nil
+		}
+	}
+
+	return encodeWith(w, NewEncoder(variables.MIMEApplicationProblemJSON, encodeJSON), &cp, cp.Status)
+}
+
+// converts err with ProblemFromError and writes it with WriteProblem
+func ErrorProblem(w http.ResponseWriter, r *http.Request, err error, status int) error {
+	return WriteProblem(w, r, ProblemFromError(err, status))
+}
+
+// writes a problem for the status with the status text as its title, a shortcut for rejections
+func StatusProblem(w http.ResponseWriter, r *http.Request, status int, detail string) error {
+	return WriteProblem(w, r, NewProblem(status, detail))
+}
@@ -0,0 +1,81 @@
+package respond
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+func writeProblemXML(t *testing.T, p *Problem) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(variables.HeaderAccept, variables.MIMEApplicationProblemXML)
+
+	var w = httptest.NewRecorder()
+	if err := WriteProblem(w, r, p); err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+func TestWriteProblemXMLExtensions(t *testing.T) {
+	type field struct {
+		Name string `xml:"name"`
+	}
+
+	var tests = []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"string map", map[string]string{"email": "required"}, "<errors><email>required</email></errors>"},
+		{"nested", map[string][]string{"email": {"required", "invalid"}}, "<errors><email><i>required</i><i>invalid</i></email></errors>"},
+		{"int slice", []int{1, 2}, "<errors><i>1</i><i>2</i></errors>"},
+		{"struct slice", []field{{"a"}}, "<errors><i><name>a</name></i></errors>"},
+		{"pointer to map", &map[string]int{"n": 1}, "<errors><n>1</n></errors>"},
+		{"bytes", []byte("raw"), "<errors>raw</errors>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w = writeProblemXML(t, NewProblem(http.StatusBadRequest, "").With("errors", tt.value))
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+
+			if got := w.Header().Get(variables.HeaderContentType); got != variables.MIMEApplicationProblemXML {
+				t.Errorf("content type = %q", got)
+			}
+
+			if !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("body %s does not contain %s", w.Body.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteProblemXMLFallsBackToJSON(t *testing.T) {
+	type withMap struct {
+		Fields map[string]string
+	}
+
+	var w = writeProblemXML(t, NewProblem(http.StatusBadRequest, "").With("errors", withMap{Fields: map[string]string{"a": "b"}}))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+
+	if got := w.Header().Get(variables.HeaderContentType); got != variables.MIMEApplicationProblemJSON {
+		t.Errorf("content type = %q, want %q", got, variables.MIMEApplicationProblemJSON)
+	}
+
+	if !strings.Contains(w.Body.String(), `"errors":{"Fields":{"a":"b"}}`) {
+		t.Errorf("body = %s", w.Body.String())
+	}
+}
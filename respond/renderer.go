@@ -0,0 +1,89 @@
+package respond
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	texttemplate "text/template"
+)
+
+// executes named templates so html/template and text/template can be rendered as any mime type
+//
+// *html/template.Template and *text/template.Template satisfy it directly, wrap them with HTMLRenderer
+// or TextRenderer to get ErrTemplateNotFound for missing names
+type TemplateRenderer interface {
+	// returns ErrTemplateNotFound if there is no template by the given name
+	ExecuteTemplate(w io.Writer, name string, data any) error
+}
+
+type htmlRenderer struct {
+	t *htmltemplate.Template
+}
+
+func (r htmlRenderer) ExecuteTemplate(w io.Writer, name string, data any) error {
+	if r.t.Lookup(name) == nil {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	return r.t.ExecuteTemplate(w, name, data)
+}
+
+type textRenderer struct {
+	t *texttemplate.Template
+}
+
+func (r textRenderer) ExecuteTemplate(w io.Writer, name string, data any) error {
+	if r.t.Lookup(name) == nil {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	return r.t.ExecuteTemplate(w, name, data)
+}
+
+// adapts an html/template set to TemplateRenderer
+func HTMLRenderer(t *htmltemplate.Template) TemplateRenderer {
+	return htmlRenderer{t: t}
+}
+
+// adapts a text/template set to TemplateRenderer, text/template does no escaping
+func TextRenderer(t *texttemplate.Template) TemplateRenderer {
+	return textRenderer{t: t}
+}
+
+// executes the given template name in tr to a buffer
+//
+// returns ErrTemplateNotFound if given template name was not found in tr
+//
+// sets content length of the buffer
+//
+// sets content type to mimeType
+//
+// writes buffer to w
+func RenderTemplate(w http.ResponseWriter, tr TemplateRenderer, mimeType, name string, data any, code int) error {
+	var buf = getBuffer(templateSizes.get(name))
+	defer putBuffer(buf)
+
+	if err := tr.ExecuteTemplate(buf, name, data); err != nil {
+		return err
+	}
+
+	templateSizes.observe(name, buf.Len())
+
+	Blob(w, mimeType, buf.Bytes(), code)
+
+	return nil
+}
+
+// checks for existence of template by given name
+//
+// returns ErrTemplateNotFound if given template name was not found in t
+//
+// executes the given template name in t to a buffer
+//
+// sets content type to mimeType, such as text plain, text csv or application yaml
+//
+// writes buffer to w
+func TextTemplate(w http.ResponseWriter, t *texttemplate.Template, mimeType, name string, data any, code int) error {
+	return RenderTemplate(w, TextRenderer(t), mimeType, name, data, code)
+}
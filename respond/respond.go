@@ -1,17 +1,42 @@
 package respond
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
 	"html/template"
 	"io"
 	"net/http"
 
 	"github.com/brody192/ext/set"
+	"github.com/brody192/ext/utilities"
 	"github.com/brody192/ext/variables"
 )
 
+// writes msg as plain text like http.Error
+//
+// if the request carries a request id it is echoed on the header middleware.RequestID was configured with
+// and appended to the body
+func Error(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	var ctx = r.Context()
+	var id = utilities.GetRequestID(ctx)
+
+	if id != "" {
+		var header = utilities.GetRequestIDHeader(ctx)
+		if header == "" {
+			header = variables.HeaderXRequestID
+		}
+
+		if w.Header().Get(header) == "" {
+			w.Header().Set(header, id)
+		}
+
+		msg += "\nrequest id: " + id
+	}
+
+	w.Header().Del(variables.HeaderContentLength)
+	w.Header().Set(variables.HeaderXContentTypeOptions, "nosniff")
+
+	PlainText(w, msg+"\n", code)
+}
+
 // accepts a byte slice
 //
 // sets content length of v
@@ -26,6 +51,14 @@ func Blob(w http.ResponseWriter, mimeType string, v []byte, code int) {
 	w.Write(v)
 }
 
+// like Blob but writes v with io.WriteString so it isn't copied into a byte slice
+func blobString(w http.ResponseWriter, mimeType string, v string, code int) {
+	set.ContentLength(w, len(v))
+	w.Header().Set(variables.HeaderContentType, mimeType)
+	w.WriteHeader(code)
+	io.WriteString(w, v)
+}
+
 // accepts a string
 //
 // sets content length of v
@@ -34,7 +67,7 @@ func Blob(w http.ResponseWriter, mimeType string, v []byte, code int) {
 //
 // writes v to w
 func PlainText(w http.ResponseWriter, v string, code int) {
-	Blob(w, variables.MIMETextPlainCharsetUTF8, []byte(v), code)
+	blobString(w, variables.MIMETextPlainCharsetUTF8, v, code)
 }
 
 // accepts a byte slice
@@ -56,7 +89,7 @@ func PlainTextBlob(w http.ResponseWriter, v []byte, code int) {
 //
 // writes v to w
 func HTML(w http.ResponseWriter, v string, code int) {
-	Blob(w, variables.MIMETextHTMLCharsetUTF8, []byte(v), code)
+	blobString(w, variables.MIMETextHTMLCharsetUTF8, v, code)
 }
 
 // accepts a byte slice
@@ -78,7 +111,7 @@ func HTMLBlob(w http.ResponseWriter, v []byte, code int) {
 //
 // writes v to w
 func JSONString(w http.ResponseWriter, v string, code int) {
-	Blob(w, variables.MIMEApplicationJSONCharsetUTF8, []byte(v), code)
+	blobString(w, variables.MIMEApplicationJSONCharsetUTF8, v, code)
 }
 
 // accepts a byte slice
@@ -100,7 +133,7 @@ func JSONBlob(w http.ResponseWriter, v []byte, code int) {
 //
 // writes buffer to w
 //
-// resets buffer
+// returns buffer to the pool
 func JSON(w http.ResponseWriter, v any, code int) {
 	jsonIndented(w, v, "", code)
 }
@@ -113,33 +146,22 @@ func JSON(w http.ResponseWriter, v any, code int) {
 //
 // writes buffer to w
 //
-// resets buffer
+// returns buffer to the pool
 func JSONIndented(w http.ResponseWriter, v any, code int) {
 	jsonIndented(w, v, "  ", code)
 }
 
 func jsonIndented(w http.ResponseWriter, v any, indent string, code int) {
-	var buf = &bytes.Buffer{}
-	var enc = json.NewEncoder(buf)
-	enc.SetIndent("", indent)
-	enc.SetEscapeHTML(true)
-	if err := enc.Encode(v); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	JSONBlob(w, buf.Bytes(), code)
-
-	buf.Reset()
+	encodeWith(w, jsonEncoder{indent: indent}, v, code)
 }
 
 // if no content type header was previously set MIMEOctetStream will be used
 //
 // copy's re to w
+//
+// see StreamWith for length, flushing, cancellation and range support
 func Stream(w http.ResponseWriter, re io.Reader, code int) error {
-	if ct := w.Header().Get(variables.HeaderContentType); ct != "" {
-		w.Header().Set(variables.HeaderContentType, variables.MIMEOctetStream)
-	}
+	setDefaultContentType(w, variables.MIMEOctetStream)
 
 	w.WriteHeader(code)
 
@@ -155,22 +177,9 @@ func Stream(w http.ResponseWriter, re io.Reader, code int) error {
 //
 // writes buffer to w
 //
-// resets buffer
+// returns buffer to the pool
+//
+// see RenderTemplate for text/template and other mime types
 func Template(w http.ResponseWriter, t *template.Template, name string, data any, code int) error {
-	var templateToExecute = t.Lookup(name)
-	if templateToExecute == nil {
-		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
-	}
-
-	var buf = &bytes.Buffer{}
-	var err = templateToExecute.ExecuteTemplate(buf, name, data)
-	if err != nil {
-		return err
-	}
-
-	HTMLBlob(w, buf.Bytes(), code)
-
-	buf.Reset()
-
-	return err
+	return RenderTemplate(w, HTMLRenderer(t), variables.MIMETextHTMLCharsetUTF8, name, data, code)
 }
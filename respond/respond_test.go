@@ -0,0 +1,44 @@
+package respond
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brody192/ext/utilities"
+	"github.com/brody192/ext/variables"
+)
+
+func TestErrorEchoesRequestIDHeader(t *testing.T) {
+	var tests = []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"configured header", "X-Correlation-ID", "X-Correlation-ID"},
+		{"no header stored", "", variables.HeaderXRequestID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r = httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(utilities.WithRequestID(r.Context(), "abc", tt.header))
+
+			var w = httptest.NewRecorder()
+			Error(w, r, "boom", http.StatusInternalServerError)
+
+			if got := w.Header().Get(tt.want); got != "abc" {
+				t.Errorf("%s = %q, want abc", tt.want, got)
+			}
+
+			if tt.want != variables.HeaderXRequestID && w.Header().Get(variables.HeaderXRequestID) != "" {
+				t.Errorf("id was also echoed on %s", variables.HeaderXRequestID)
+			}
+
+			if !strings.HasSuffix(w.Body.String(), "request id: abc\n") {
+				t.Errorf("body = %q", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+package respond
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+// a single server-sent event, empty fields are omitted
+type Event struct {
+	ID    string
+	Event string
+	// split into one data line per line, so multi-line payloads arrive intact
+	Data string
+	// reconnection time the client should use, sent in milliseconds
+	Retry time.Duration
+	// written as comment lines which clients ignore
+	Comment string
+}
+
+type SSEConfig struct {
+	// interval at which a comment is sent to keep proxies from closing an idle connection,
+	// defaults to 15 seconds, a negative value disables heartbeats
+	Heartbeat time.Duration
+	// reconnection time sent to the client when the stream opens, not sent when zero
+	Retry time.Duration
+}
+
+func (c *SSEConfig) loadDefaults() {
+	if c.Heartbeat == 0 {
+		c.Heartbeat = 15 * time.Second
+	}
+}
+
+// an open text/event-stream response, safe for concurrent use
+//
+// the stream stops when the request context is cancelled or Close is called,
+// Close must be called before the handler returns
+type SSE struct {
+	rc          *http.ResponseController
+	w           http.ResponseWriter
+	ctx         context.Context
+	cancel      context.CancelFunc
+	lastEventID string
+
+	mu  sync.Mutex
+	err error
+
+	heartbeat sync.WaitGroup
+}
+
+// starts an event stream on w
+//
+// sets content type to text/event-stream and disables caching and proxy buffering
+//
+// writes the status and flushes the headers,
+// returns http.ErrNotSupported without writing anything if w can't be flushed
+func NewSSE(w http.ResponseWriter, r *http.Request, c *SSEConfig) (*SSE, error) {
+	if !canFlush(w) {
+		return nil, http.ErrNotSupported
+	}
+
+	if c == nil {
+		c = &SSEConfig{}
+	}
+
+	c.loadDefaults()
+
+	var ctx, cancel = context.WithCancel(r.Context())
+
+	var s = &SSE{
+		rc:          http.NewResponseController(w),
+		w:           w,
+		ctx:         ctx,
+		cancel:      cancel,
+		lastEventID: r.Header.Get(variables.HeaderLastEventID),
+	}
+
+	var h = w.Header()
+	h.Del(variables.HeaderContentLength)
+	h.Set(variables.HeaderContentType, variables.MIMETextEventStreamCharsetUTF8)
+	h.Set(variables.HeaderCacheControl, "no-cache")
+	h.Set(variables.HeaderXAccelBuffering, "no")
+
+	// connection specific headers are not allowed in HTTP/2 and later
+	if r.ProtoMajor == 1 {
+		h.Set(variables.HeaderConnection, "keep-alive")
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	if c.Retry > 0 {
+		if err := s.send(&Event{Retry: c.Retry}); err != nil {
+			cancel()
+			return nil, err
+		}
+	} else if err := s.rc.Flush(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if c.Heartbeat > 0 {
+		s.heartbeat.Add(1)
+		go s.keepAlive(c.Heartbeat)
+	}
+
+	return s, nil
+}
+
+// reports whether the innermost writer w wraps can flush
+//
+// wrappers that expose Unwrap are looked through even when they have a Flush method,
+// middleware wrappers tend to implement Flush whether or not the writer they wrap can
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+			w = u.Unwrap()
+			continue
+		}
+
+		switch w.(type) {
+		case interface{ FlushError() error }, http.Flusher:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// the Last-Event-ID sent by a reconnecting client, empty on the first connection
+func (s *SSE) LastEventID() string {
+	return s.lastEventID
+}
+
+// closed when the client goes away, a write fails or Close is called
+func (s *SSE) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// writes e and flushes it to the client
+//
+// returns ErrInvalidEvent if the id or event name contains a newline,
+// the context error once the stream has stopped, or the write error that stopped it
+func (s *SSE) Send(e Event) error {
+	if err := validateEvent(&e); err != nil {
+		return err
+	}
+
+	return s.send(&e)
+}
+
+// returns ErrInvalidEvent if the id or event name would break out of their line
+func validateEvent(e *Event) error {
+	if strings.ContainsAny(e.ID, "\r\n\x00") || strings.ContainsAny(e.Event, "\r\n") {
+		return fmt.Errorf("%w: id and event must be a single line", ErrInvalidEvent)
+	}
+
+	return nil
+}
+
+// encodes v as JSON and sends it as the data of an event with the given name
+func (s *SSE) SendJSON(event string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(Event{Event: event, Data: string(b)})
+}
+
+// stops heartbeats and waits for them to finish, further sends return context.Canceled
+func (s *SSE) Close() error {
+	s.cancel()
+	s.heartbeat.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *SSE) send(e *Event) error {
+	// field names and line breaks add a little, the buffer grows if they cross a class
+	var buf = getBuffer(len(e.Comment) + len(e.ID) + len(e.Event) + len(e.Data))
+	defer putBuffer(buf)
+
+	formatEvent(buf, e)
+
+	return s.write(buf.Bytes())
+}
+
+func (s *SSE) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, err := s.w.Write(b); err != nil {
+		s.fail(err)
+		return err
+	}
+
+	if err := s.rc.Flush(); err != nil {
+		s.fail(err)
+		return err
+	}
+
+	return nil
+}
+
+// records the first write error and stops the stream, must be called with mu held
+func (s *SSE) fail(err error) {
+	s.err = err
+	s.cancel()
+}
+
+var heartbeatComment = []byte(":\n\n")
+
+func (s *SSE) keepAlive(interval time.Duration) {
+	defer s.heartbeat.Done()
+
+	var t = time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-t.C:
+			if s.write(heartbeatComment) != nil {
+				return
+			}
+		}
+	}
+}
+
+// formats e in the text/event-stream format to buf, ending with the blank line that dispatches it
+func formatEvent(buf *bytes.Buffer, e *Event) {
+	if e.Comment != "" {
+		writeEventLines(buf, "", e.Comment)
+	}
+
+	if e.ID != "" {
+		writeEventField(buf, "id", e.ID)
+	}
+
+	if e.Event != "" {
+		writeEventField(buf, "event", e.Event)
+	}
+
+	if e.Retry > 0 {
+		writeEventField(buf, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+
+	if e.Data != "" {
+		writeEventLines(buf, "data", e.Data)
+	}
+
+	buf.WriteByte('\n')
+}
+
+// writes one field per line of v, lines may end in \r\n, \r or \n
+func writeEventLines(buf *bytes.Buffer, name, v string) {
+	v = strings.ReplaceAll(v, "\r\n", "\n")
+	v = strings.ReplaceAll(v, "\r", "\n")
+
+	for _, line := range strings.Split(v, "\n") {
+		writeEventField(buf, name, line)
+	}
+}
+
+// an empty name writes a comment line
+func writeEventField(buf *bytes.Buffer, name, v string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(v)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,105 @@
+package respond
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+// a ResponseWriter that can't flush and remembers whether a status was written
+type noFlushWriter struct {
+	discardWriter
+	code int
+}
+
+func (w *noFlushWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+// a middleware style wrapper that exposes the writer it wraps
+type unwrapWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrapWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// a wrapper that claims to flush whatever it wraps
+type flushingUnwrapWriter struct {
+	unwrapWriter
+}
+
+func (w flushingUnwrapWriter) Flush() {}
+
+func TestNewSSERequiresFlusher(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for _, w := range []http.ResponseWriter{
+		&noFlushWriter{discardWriter: *newDiscardWriter()},
+		unwrapWriter{&noFlushWriter{discardWriter: *newDiscardWriter()}},
+		flushingUnwrapWriter{unwrapWriter{&noFlushWriter{discardWriter: *newDiscardWriter()}}},
+	} {
+		s, err := NewSSE(w, r, nil)
+		if !errors.Is(err, http.ErrNotSupported) {
+			t.Fatalf("err = %v, want http.ErrNotSupported", err)
+		}
+
+		if s != nil {
+			t.Fatal("got a stream for a writer that can't flush")
+		}
+
+		var inner = w
+		for {
+			u, ok := inner.(interface{ Unwrap() http.ResponseWriter })
+			if !ok {
+				break
+			}
+
+			inner = u.Unwrap()
+		}
+
+		if code := inner.(*noFlushWriter).code; code != 0 {
+			t.Errorf("status %d was written before the flush check", code)
+		}
+
+		if inner.Header().Get(variables.HeaderContentType) != "" {
+			t.Error("headers were set before the flush check")
+		}
+	}
+}
+
+func TestSSESend(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	var w = httptest.NewRecorder()
+
+	s, err := NewSSE(unwrapWriter{w}, r, &SSEConfig{Heartbeat: -1, Retry: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send(Event{ID: "1", Event: "update", Data: "a\nb"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Send(Event{Event: "bad\nname"}); !errors.Is(err, ErrInvalidEvent) {
+		t.Errorf("err = %v, want ErrInvalidEvent", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var want = "retry: 2000\n\nid: 1\nevent: update\ndata: a\ndata: b\n\n"
+	if w.Body.String() != want {
+		t.Errorf("body = %q, want %q", w.Body.String(), want)
+	}
+
+	if got := w.Header().Get(variables.HeaderContentType); got != variables.MIMETextEventStreamCharsetUTF8 {
+		t.Errorf("content type = %q", got)
+	}
+}
@@ -0,0 +1,383 @@
+package respond
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// what a Hub does when a client's buffer is full
+type SlowConsumerPolicy int
+
+const (
+	// discard the event being published for that client
+	DropNewest SlowConsumerPolicy = iota
+	// discard the oldest buffered event to make room
+	DropOldest
+	// close the client's subscription, its stream ends and the client reconnects with Last-Event-ID
+	Disconnect
+)
+
+type HubConfig struct {
+	// events buffered per client, defaults to 64
+	BufferSize int
+	// events kept per topic for clients reconnecting with Last-Event-ID, defaults to 256, a negative value disables replay
+	ReplaySize int
+	// how long a topic without clients is kept, along with its replay, after its last event or client,
+	// defaults to 10 minutes, a negative value keeps topics until the hub is closed
+	TopicTTL time.Duration
+	// defaults to DropNewest
+	Policy SlowConsumerPolicy
+	// used by Serve to open the event stream
+	SSE *SSEConfig
+}
+
+func (c *HubConfig) loadDefaults() {
+	if c.BufferSize <= 0 {
+		c.BufferSize = 64
+	}
+
+	if c.ReplaySize == 0 {
+		c.ReplaySize = 256
+	}
+
+	if c.TopicTTL == 0 {
+		c.TopicTTL = 10 * time.Minute
+	}
+}
+
+// fans events out to the clients subscribed to a topic, safe for concurrent use
+//
+// the hub assigns every published event an increasing id, shared across topics,
+// which clients send back as Last-Event-ID when they reconnect
+//
+// topics are created on first use and dropped, along with their replay buffer,
+// once they have had no clients and no events for HubConfig.TopicTTL
+type Hub struct {
+	c   *HubConfig
+	seq atomic.Uint64
+
+	mu        sync.Mutex
+	topics    map[string]*hubTopic
+	closed    bool
+	lastSweep time.Time
+}
+
+type hubTopic struct {
+	mu      sync.Mutex
+	clients map[*Subscription]struct{}
+	replay  *eventRing
+	// time of the last event or the last client leaving
+	lastUsed time.Time
+}
+
+// creates a hub, c may be nil to use the defaults
+func NewHub(c *HubConfig) *Hub {
+	if c == nil {
+		c = &HubConfig{}
+	}
+
+	c.loadDefaults()
+
+	return &Hub{c: c, topics: map[string]*hubTopic{}, lastSweep: time.Now()}
+}
+
+// returns the topic locked, creating it if create is set, nil if the hub is closed or the topic doesn't exist
+//
+// locking it before the hub is unlocked keeps a sweep from dropping it before the caller uses it
+func (h *Hub) topic(name string, create bool) *hubTopic {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil
+	}
+
+	var now = time.Now()
+	if h.c.TopicTTL > 0 && now.Sub(h.lastSweep) >= h.c.TopicTTL {
+		h.sweep(now)
+	}
+
+	var t = h.topics[name]
+	if t == nil && create {
+		t = &hubTopic{clients: map[*Subscription]struct{}{}, lastUsed: now}
+		if h.c.ReplaySize > 0 {
+			t.replay = newEventRing(h.c.ReplaySize)
+		}
+
+		h.topics[name] = t
+	}
+
+	if t != nil {
+		t.mu.Lock()
+	}
+
+	return t
+}
+
+// drops topics that have been without clients and events for the ttl, must be called with mu held
+func (h *Hub) sweep(now time.Time) {
+	h.lastSweep = now
+
+	for name, t := range h.topics {
+		t.mu.Lock()
+		if len(t.clients) == 0 && now.Sub(t.lastUsed) >= h.c.TopicTTL {
+			delete(h.topics, name)
+		}
+		t.mu.Unlock()
+	}
+}
+
+// sends e to every client subscribed to topic and keeps it for replay
+//
+// e.ID is replaced with the id assigned by the hub, which is returned,
+// empty if the hub is closed or replay is disabled and the topic has no clients
+//
+// returns ErrInvalidEvent without sending or keeping e if SSE.Send would reject it
+func (h *Hub) Publish(topic string, e Event) (string, error) {
+	// the id is assigned below, only the rest of the event is the caller's
+	e.ID = ""
+	if err := validateEvent(&e); err != nil {
+		return "", err
+	}
+
+	var t = h.topic(topic, h.c.ReplaySize > 0)
+	if t == nil {
+		return "", nil
+	}
+
+	defer t.mu.Unlock()
+
+	t.lastUsed = time.Now()
+
+	var seq = h.seq.Add(1)
+	e.ID = strconv.FormatUint(seq, 10)
+
+	if t.replay != nil {
+		t.replay.push(seq, e)
+	}
+
+	for s := range t.clients {
+		if !s.offer(e, h.c.Policy) {
+			delete(t.clients, s)
+			s.close()
+		}
+	}
+
+	return e.ID, nil
+}
+
+// subscribes to topic, events published after lastEventID that are still kept for replay are delivered first
+//
+// an empty or unknown lastEventID replays nothing, the subscription is closed immediately if the hub is closed
+func (h *Hub) Subscribe(topic, lastEventID string) *Subscription {
+	var s = &Subscription{done: make(chan struct{})}
+
+	var t = h.topic(topic, true)
+	if t == nil {
+		s.close()
+		return s
+	}
+
+	defer t.mu.Unlock()
+
+	var missed []Event
+	if last, err := strconv.ParseUint(lastEventID, 10, 64); err == nil && t.replay != nil {
+		missed = t.replay.since(last)
+	}
+
+	// room for the whole replay so reconnecting never starts out as a slow consumer
+	s.events = make(chan Event, h.c.BufferSize+len(missed))
+	for _, e := range missed {
+		s.events <- e
+	}
+
+	s.unsubscribe = func() {
+		t.mu.Lock()
+		if _, ok := t.clients[s]; ok {
+			delete(t.clients, s)
+			t.lastUsed = time.Now()
+		}
+		t.mu.Unlock()
+	}
+
+	t.clients[s] = struct{}{}
+
+	return s
+}
+
+// streams topic to the client as server-sent events until the client goes away,
+// its subscription is closed by the slow consumer policy, or the hub is closed
+//
+// the client's Last-Event-ID header decides which events are replayed
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, topic string) error {
+	var cfg *SSEConfig
+	if h.c.SSE != nil {
+		var c = *h.c.SSE
+		cfg = &c
+	}
+
+	sse, err := NewSSE(w, r, cfg)
+	if err != nil {
+		return err
+	}
+
+	defer sse.Close()
+
+	var sub = h.Subscribe(topic, sse.LastEventID())
+	defer sub.Close()
+
+	for {
+		select {
+		case e := <-sub.Events():
+			if err := sse.Send(e); err != nil {
+				return err
+			}
+		case <-sub.Done():
+			return nil
+		case <-sse.Done():
+			return sse.Close()
+		}
+	}
+}
+
+// number of clients subscribed to topic
+func (h *Hub) Clients(topic string) int {
+	var t = h.topic(topic, false)
+	if t == nil {
+		return 0
+	}
+
+	defer t.mu.Unlock()
+
+	return len(t.clients)
+}
+
+// closes every subscription and drops all topics, later subscriptions are closed immediately
+func (h *Hub) Close() {
+	h.mu.Lock()
+	var topics = h.topics
+	h.topics = nil
+	h.closed = true
+	h.mu.Unlock()
+
+	for _, t := range topics {
+		t.mu.Lock()
+		for s := range t.clients {
+			delete(t.clients, s)
+			s.close()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// a client's subscription to a hub topic
+type Subscription struct {
+	events      chan Event
+	done        chan struct{}
+	closeOnce   sync.Once
+	unsubscribe func()
+	dropped     atomic.Uint64
+}
+
+// buffered events for the client, never closed, select on Done as well
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// closed when the subscription is closed by Close, the slow consumer policy or the hub closing
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// number of events discarded because the client's buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// removes the subscription from its topic
+func (s *Subscription) Close() {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// buffers e without blocking, returns false if the subscription should be closed
+func (s *Subscription) offer(e Event, policy SlowConsumerPolicy) bool {
+	select {
+	case s.events <- e:
+		return true
+	default:
+	}
+
+	switch policy {
+	case Disconnect:
+		return false
+	case DropOldest:
+		select {
+		case <-s.events:
+			s.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	default:
+		s.dropped.Add(1)
+	}
+
+	return true
+}
+
+// fixed size ring of the most recent events and their sequence numbers
+type eventRing struct {
+	seqs   []uint64
+	events []Event
+	next   int
+	full   bool
+}
+
+func newEventRing(size int) *eventRing {
+	return &eventRing{seqs: make([]uint64, size), events: make([]Event, size)}
+}
+
+func (r *eventRing) push(seq uint64, e Event) {
+	r.seqs[r.next] = seq
+	r.events[r.next] = e
+
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// returns the kept events with a sequence number after seq, oldest first
+func (r *eventRing) since(seq uint64) []Event {
+	var start, n = 0, r.next
+	if r.full {
+		start, n = r.next, len(r.events)
+	}
+
+	var out []Event
+	for i := 0; i < n; i++ {
+		var idx = (start + i) % len(r.events)
+		if r.seqs[idx] > seq {
+			out = append(out, r.events[idx])
+		}
+	}
+
+	return out
+}
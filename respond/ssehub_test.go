@@ -0,0 +1,172 @@
+package respond
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func (h *Hub) hasTopic(name string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := h.topics[name]
+	return ok
+}
+
+func mustPublish(t *testing.T, h *Hub, topic string, e Event) string {
+	t.Helper()
+
+	id, err := h.Publish(topic, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+func TestHubReplay(t *testing.T) {
+	var h = NewHub(nil)
+	defer h.Close()
+
+	var first = mustPublish(t, h, "news", Event{Data: "a"})
+	mustPublish(t, h, "news", Event{Data: "b"})
+	mustPublish(t, h, "news", Event{Data: "c"})
+
+	var sub = h.Subscribe("news", first)
+	defer sub.Close()
+
+	for _, want := range []string{"b", "c"} {
+		select {
+		case e := <-sub.Events():
+			if e.Data != want {
+				t.Fatalf("got %q, want %q", e.Data, want)
+			}
+		default:
+			t.Fatalf("missing replayed event %q", want)
+		}
+	}
+}
+
+func TestHubDropsIdleTopics(t *testing.T) {
+	var h = NewHub(&HubConfig{TopicTTL: 20 * time.Millisecond})
+	defer h.Close()
+
+	var idle = h.Subscribe("idle", "")
+	var id = mustPublish(t, h, "idle", Event{Data: "x"})
+	idle.Close()
+
+	var live = h.Subscribe("live", "")
+	defer live.Close()
+
+	// a client reconnecting within the ttl still gets the replay
+	var again = h.Subscribe("idle", "0")
+	select {
+	case e := <-again.Events():
+		if e.ID != id {
+			t.Fatalf("replayed %q, want %q", e.ID, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing replayed within the ttl")
+	}
+	again.Close()
+
+	time.Sleep(40 * time.Millisecond)
+
+	// any use of the hub sweeps once the ttl has passed
+	mustPublish(t, h, "other", Event{Data: "y"})
+
+	if h.hasTopic("idle") {
+		t.Error("idle topic was kept past its ttl")
+	}
+
+	if !h.hasTopic("live") {
+		t.Error("topic with a client was dropped")
+	}
+
+	// a dropped topic starts over with an empty replay
+	var fresh = h.Subscribe("idle", "0")
+	defer fresh.Close()
+
+	select {
+	case e := <-fresh.Events():
+		t.Errorf("replayed %q from a dropped topic", e.Data)
+	default:
+	}
+}
+
+// an invalid event must be rejected up front instead of being replayed to every client that reconnects
+func TestHubPublishInvalidEvent(t *testing.T) {
+	var h = NewHub(&HubConfig{SSE: &SSEConfig{Heartbeat: -1}})
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.Serve(w, r, "news")
+	}))
+	defer srv.Close()
+	// ends the Serve loops before the server waits for them
+	defer h.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// the stream opened, so the client is subscribed once Clients sees it
+	for deadline := time.Now().Add(time.Second); h.Clients("news") == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("client never subscribed")
+		}
+	}
+
+	if id, err := h.Publish("news", Event{Event: "bad\nname", Data: "x"}); !errors.Is(err, ErrInvalidEvent) || id != "" {
+		t.Fatalf("got %q %v, want ErrInvalidEvent", id, err)
+	}
+
+	var id = mustPublish(t, h, "news", Event{Event: "update", Data: "ok"})
+
+	var got = make(chan string, 1)
+	go func() {
+		var br = bufio.NewReader(resp.Body)
+		var lines []string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			if line == "\n" {
+				got <- strings.Join(lines, "")
+				return
+			}
+
+			lines = append(lines, line)
+		}
+	}()
+
+	select {
+	case e := <-got:
+		if want := "id: " + id + "\nevent: update\ndata: ok\n"; e != want {
+			t.Errorf("got %q, want %q", e, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the topic stopped serving after an invalid event")
+	}
+
+	// a reconnecting client replays from before the invalid event without hitting it
+	var sub = h.Subscribe("news", "0")
+	defer sub.Close()
+
+	select {
+	case e := <-sub.Events():
+		if e.ID != id {
+			t.Errorf("replayed %q, want %q", e.ID, id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("nothing replayed")
+	}
+}
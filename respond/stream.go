@@ -0,0 +1,219 @@
+package respond
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brody192/ext/set"
+	"github.com/brody192/ext/variables"
+)
+
+type StreamConfig struct {
+	// sets content length when greater than zero, leave unset when the size isn't known
+	Size int64
+	// longest time written data may sit in the response buffer, flushed by a timer even while the reader blocks,
+	// a negative value flushes after every write, zero only flushes when the copy is done
+	FlushInterval time.Duration
+	// used by http.ServeContent to pick a content type from the extension when none is set
+	Name string
+	// sent as Last-Modified and checked against If-Modified-Since and If-Range when not zero
+	ModTime time.Time
+}
+
+// copy's re to w, stopping with the context's error when the client goes away
+//
+// an io.ReadSeeker with code http.StatusOK is served with http.ServeContent,
+// which handles Range, If-Range and the other conditional headers and works out the length itself,
+// its content type is picked from Name or sniffed when not set
+//
+// anything else uses MIMEOctetStream if no content type header was previously set,
+// sets content length to Size and flushes every FlushInterval
+func StreamWith(w http.ResponseWriter, r *http.Request, re io.Reader, code int, c *StreamConfig) error {
+	if c == nil {
+		c = &StreamConfig{}
+	}
+
+	var ctx = r.Context()
+
+	if rs, ok := re.(io.ReadSeeker); ok && code == http.StatusOK {
+		var cr = &ctxReadSeeker{ctx: ctx, ReadSeeker: rs}
+		http.ServeContent(w, r, c.Name, c.ModTime, cr)
+
+		if cr.err != nil {
+			return cr.err
+		}
+
+		return ctx.Err()
+	}
+
+	setDefaultContentType(w, variables.MIMEOctetStream)
+
+	if c.Size > 0 {
+		set.ContentLength(w, c.Size)
+	}
+
+	if !c.ModTime.IsZero() {
+		w.Header().Set(variables.HeaderLastModified, c.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	w.WriteHeader(code)
+
+	return copyFlushing(ctx, w, re, c.FlushInterval)
+}
+
+// copies src to w through a latencyWriter, flushing once more when the copy is done
+func copyFlushing(ctx context.Context, w http.ResponseWriter, src io.Reader, interval time.Duration) error {
+	var lw = newLatencyWriter(w, interval)
+	var buf = make([]byte, 32*1024)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			lw.stop()
+			return err
+		}
+
+		var n, readErr = src.Read(buf)
+		if n > 0 {
+			if _, err := lw.Write(buf[:n]); err != nil {
+				lw.stop()
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+
+		if readErr != nil {
+			lw.stop()
+			return readErr
+		}
+	}
+
+	return lw.stop()
+}
+
+// writes to a response and flushes it at most interval after a write, like httputil's maxLatencyWriter
+//
+// the flush runs on a timer so data isn't held back while the caller blocks waiting for more,
+// a negative interval flushes after every write and zero leaves flushing to stop
+type latencyWriter struct {
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	interval time.Duration
+
+	mu      sync.Mutex
+	t       *time.Timer
+	pending bool
+	stopped bool
+	// first error from a timer flush, returned by the next write
+	err error
+}
+
+func newLatencyWriter(w http.ResponseWriter, interval time.Duration) *latencyWriter {
+	return &latencyWriter{w: w, rc: http.NewResponseController(w), interval: interval}
+}
+
+func (lw *latencyWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if lw.err != nil {
+		return 0, lw.err
+	}
+
+	n, err := lw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	switch {
+	case lw.interval < 0:
+		return n, lw.flush()
+	case lw.interval == 0 || lw.pending || lw.stopped:
+		return n, nil
+	}
+
+	lw.pending = true
+
+	if lw.t == nil {
+		lw.t = time.AfterFunc(lw.interval, lw.delayedFlush)
+	} else {
+		lw.t.Reset(lw.interval)
+	}
+
+	return n, nil
+}
+
+func (lw *latencyWriter) delayedFlush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if !lw.pending || lw.stopped {
+		return
+	}
+
+	lw.pending = false
+
+	if err := lw.flush(); err != nil && lw.err == nil {
+		lw.err = err
+	}
+}
+
+// stops the timer and flushes what is left, must be called before the handler returns
+func (lw *latencyWriter) stop() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.stopped = true
+	lw.pending = false
+
+	if lw.t != nil {
+		lw.t.Stop()
+	}
+
+	if lw.err != nil {
+		return lw.err
+	}
+
+	return lw.flush()
+}
+
+// flushes the response, writers that can't flush are left to net/http
+func (lw *latencyWriter) flush() error {
+	if err := lw.rc.Flush(); !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	return nil
+}
+
+// stops reads once the context is done and remembers the first read error
+type ctxReadSeeker struct {
+	ctx context.Context
+	io.ReadSeeker
+	err error
+}
+
+func (r *ctxReadSeeker) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n, err = r.ReadSeeker.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+
+	return n, err
+}
+
+func setDefaultContentType(w http.ResponseWriter, mimeType string) {
+	if w.Header().Get(variables.HeaderContentType) == "" {
+		w.Header().Set(variables.HeaderContentType, mimeType)
+	}
+}
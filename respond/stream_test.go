@@ -0,0 +1,105 @@
+package respond
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestStreamContentType(t *testing.T) {
+	var w = httptest.NewRecorder()
+	Stream(w, strings.NewReader("x"), http.StatusOK)
+
+	if got := w.Header().Get(variables.HeaderContentType); got != variables.MIMEOctetStream {
+		t.Errorf("content type = %q, want %q", got, variables.MIMEOctetStream)
+	}
+
+	w = httptest.NewRecorder()
+	w.Header().Set(variables.HeaderContentType, "text/csv")
+	Stream(w, strings.NewReader("x"), http.StatusOK)
+
+	if got := w.Header().Get(variables.HeaderContentType); got != "text/csv" {
+		t.Errorf("content type = %q, want text/csv", got)
+	}
+}
+
+func TestStreamWithRange(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(variables.HeaderRange, "bytes=2-4")
+
+	var w = httptest.NewRecorder()
+	if err := StreamWith(w, r, strings.NewReader("0123456789"), http.StatusOK, &StreamConfig{Name: "a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" {
+		t.Errorf("got %d %q, want 206 \"234\"", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamWithSize(t *testing.T) {
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var w = httptest.NewRecorder()
+	if err := StreamWith(w, r, io.MultiReader(strings.NewReader("abc")), http.StatusCreated, &StreamConfig{Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusCreated || w.Header().Get(variables.HeaderContentLength) != "3" || !w.Flushed {
+		t.Errorf("got %d %v flushed=%v", w.Code, w.Header(), w.Flushed)
+	}
+}
+
+// data written before the reader blocks must reach the client within the flush interval
+func TestStreamWithFlushesWhileReaderBlocks(t *testing.T) {
+	var pr, pw = io.Pipe()
+
+	var srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		StreamWith(w, r, pr, http.StatusOK, &StreamConfig{FlushInterval: 20 * time.Millisecond})
+	}))
+	defer srv.Close()
+	// unblocks the handler before the server waits for it
+	defer pw.Close()
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	var req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+	go func() {
+		pw.Write([]byte("a"))
+		// a flush happens here, then another byte arrives and the reader blocks
+		time.Sleep(50 * time.Millisecond)
+		pw.Write([]byte("b"))
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var got = make(chan string, 1)
+	go func() {
+		var br = bufio.NewReader(resp.Body)
+		var b = make([]byte, 2)
+		io.ReadFull(br, b)
+		got <- string(b)
+	}()
+
+	select {
+	case s := <-got:
+		if s != "ab" {
+			t.Errorf("got %q, want ab", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second write was not flushed while the reader blocked")
+	}
+}
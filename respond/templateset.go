@@ -0,0 +1,324 @@
+package respond
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/brody192/ext/variables"
+)
+
+type TemplateSetConfig struct {
+	// where templates are loaded from, such as an embed.FS or os.DirFS
+	FS fs.FS
+	// directory of layout templates shared by every page, defaults to layouts
+	Layouts string
+	// directory of partial templates shared by every page, defaults to partials
+	Partials string
+	// directory of pages, each parsed together with the layouts and partials into its own set, defaults to pages
+	//
+	// pages are named by their path inside the directory without the extension, such as users/show
+	Pages string
+	// only files with this extension are parsed, defaults to .html
+	Extension string
+	// registered before parsing so every template can use them
+	Funcs template.FuncMap
+	// template executed for full pages, defaults to layout, pages without it are executed directly
+	Layout string
+	// template executed for fragments, defaults to content, pages without it are executed directly
+	Fragment string
+	// re-parse the templates when a file changes, for development, checked before each render
+	Reload bool
+}
+
+func (c *TemplateSetConfig) loadDefaults() {
+	if c.Layouts == "" {
+		c.Layouts = "layouts"
+	}
+
+	if c.Partials == "" {
+		c.Partials = "partials"
+	}
+
+	if c.Pages == "" {
+		c.Pages = "pages"
+	}
+
+	if c.Extension == "" {
+		c.Extension = ".html"
+	}
+
+	if c.Layout == "" {
+		c.Layout = "layout"
+	}
+
+	if c.Fragment == "" {
+		c.Fragment = "content"
+	}
+}
+
+// pages parsed with shared layouts and partials from an fs.FS, safe for concurrent use
+//
+// parsed pages are cached, with Reload set they are re-parsed when a file's size or modification time changes
+type TemplateSet struct {
+	c *TemplateSetConfig
+
+	mu          sync.RWMutex
+	pages       map[string]*template.Template
+	fingerprint string
+
+	// buffer size hints keyed by page
+	pageSizes     sizeHints
+	fragmentSizes sizeHints
+}
+
+// parses every page in c.FS, returns the first parse error
+func NewTemplateSet(c *TemplateSetConfig) (*TemplateSet, error) {
+	if c.FS == nil {
+		return nil, errors.New("template set requires an FS")
+	}
+
+	c.loadDefaults()
+
+	var s = &TemplateSet{c: c}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// the files with the configured extension below dir, a missing dir has none
+func (s *TemplateSet) files(dir string) ([]string, error) {
+	var files []string
+
+	var err = fs.WalkDir(s.c.FS, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && path.Ext(p) == s.c.Extension {
+			files = append(files, p)
+		}
+
+		return nil
+	})
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return files, err
+}
+
+// size and modification time of every template file, used to notice changes
+func (s *TemplateSet) fingerprintFiles() (string, error) {
+	var b strings.Builder
+
+	for _, dir := range []string{s.c.Layouts, s.c.Partials, s.c.Pages} {
+		files, err := s.files(dir)
+		if err != nil {
+			return "", err
+		}
+
+		for _, f := range files {
+			info, err := fs.Stat(s.c.FS, f)
+			if err != nil {
+				return "", err
+			}
+
+			fmt.Fprintf(&b, "%s:%d:%d;", f, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	return b.String(), nil
+}
+
+// parses the layouts and partials once, then clones them for every page
+func (s *TemplateSet) load() error {
+	fingerprint, err := s.fingerprintFiles()
+	if err != nil {
+		return err
+	}
+
+	var base = template.New("").Funcs(s.c.Funcs)
+
+	for _, dir := range []string{s.c.Layouts, s.c.Partials} {
+		files, err := s.files(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range files {
+			if err := s.parseFile(base, f, strings.TrimSuffix(f, s.c.Extension)); err != nil {
+				return err
+			}
+		}
+	}
+
+	pageFiles, err := s.files(s.c.Pages)
+	if err != nil {
+		return err
+	}
+
+	var pages = make(map[string]*template.Template, len(pageFiles))
+
+	for _, f := range pageFiles {
+		var name = strings.TrimSuffix(strings.TrimPrefix(f, s.c.Pages+"/"), s.c.Extension)
+
+		t, err := base.Clone()
+		if err != nil {
+			return err
+		}
+
+		if err := s.parseFile(t, f, name); err != nil {
+			return err
+		}
+
+		pages[name] = t
+	}
+
+	s.mu.Lock()
+	s.pages = pages
+	s.fingerprint = fingerprint
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *TemplateSet) parseFile(t *template.Template, file, name string) error {
+	b, err := fs.ReadFile(s.c.FS, file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.New(name).Parse(string(b)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// re-parses the set if Reload is set and a file changed
+func (s *TemplateSet) reload() error {
+	if !s.c.Reload {
+		return nil
+	}
+
+	fingerprint, err := s.fingerprintFiles()
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	var changed = fingerprint != s.fingerprint
+	s.mu.RUnlock()
+
+	if !changed {
+		return nil
+	}
+
+	return s.load()
+}
+
+// returns the parsed page, reloading first in development
+func (s *TemplateSet) page(name string) (*template.Template, error) {
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	var t = s.pages[name]
+	s.mu.RUnlock()
+
+	if t == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+
+	return t, nil
+}
+
+// the names of the parsed pages
+func (s *TemplateSet) Pages() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var names = make([]string, 0, len(s.pages))
+	for name := range s.pages {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// renders the fragment for htmx requests that aren't boosted and the full page otherwise
+//
+// sets Vary to HX-Request
+func (s *TemplateSet) Render(w http.ResponseWriter, r *http.Request, page string, data any, code int) error {
+	w.Header().Add(variables.HeaderVary, variables.HeaderHXRequest)
+
+	if IsFragmentRequest(r) {
+		return s.RenderFragment(w, page, s.c.Fragment, data, code)
+	}
+
+	return s.RenderPage(w, page, data, code)
+}
+
+// executes the page's layout template to a buffer, or the page itself if it has no layout
+//
+// returns ErrTemplateNotFound if the page does not exist
+//
+// writes buffer to w
+func (s *TemplateSet) RenderPage(w http.ResponseWriter, page string, data any, code int) error {
+	return s.execute(w, page, s.c.Layout, data, code)
+}
+
+// executes the named template of the page to a buffer, or the page itself if it doesn't define one
+//
+// returns ErrTemplateNotFound if the page does not exist
+//
+// writes buffer to w
+func (s *TemplateSet) RenderFragment(w http.ResponseWriter, page, name string, data any, code int) error {
+	return s.execute(w, page, name, data, code)
+}
+
+func (s *TemplateSet) execute(w http.ResponseWriter, page, name string, data any, code int) error {
+	t, err := s.page(page)
+	if err != nil {
+		return err
+	}
+
+	if t.Lookup(name) == nil {
+		name = page
+	}
+
+	// full pages and fragments of the same page differ in size, so they're hinted separately
+	var sizes = &s.fragmentSizes
+	if name == s.c.Layout {
+		sizes = &s.pageSizes
+	}
+
+	var buf = getBuffer(sizes.get(page))
+	defer putBuffer(buf)
+
+	if err := t.ExecuteTemplate(buf, name, data); err != nil {
+		return err
+	}
+
+	sizes.observe(page, buf.Len())
+
+	HTMLBlob(w, buf.Bytes(), code)
+
+	return nil
+}
+
+// reports whether r is an htmx request that expects a fragment, boosted requests expect a full page
+func IsFragmentRequest(r *http.Request) bool {
+	return r.Header.Get(variables.HeaderHXRequest) == "true" && r.Header.Get(variables.HeaderHXBoosted) != "true"
+}
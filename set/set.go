@@ -3,6 +3,7 @@ package set
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/brody192/ext/variables"
 )
@@ -18,8 +19,60 @@ func ContentType(w http.ResponseWriter, mimeType string) {
 }
 
 // sets content disposition header to attachment with provided filename
+//
+// filenames that aren't plain ascii are also sent as an RFC 5987 filename* parameter,
+// with an ascii fallback in filename for clients that don't support it (RFC 6266)
 func AttachmentFilename(w http.ResponseWriter, filename string) {
-	w.Header().Set(variables.HeaderContentDisposition, "attachment; filename=\""+filename+"\"")
+	w.Header().Set(variables.HeaderContentDisposition, "attachment; "+dispositionFilename(filename))
+}
+
+// the filename parameters of a content disposition header
+func dispositionFilename(filename string) string {
+	var fallback strings.Builder
+	var plain = true
+
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(r)
+		case r < 0x20 || r >= 0x7f:
+			fallback.WriteByte('_')
+			plain = false
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	var param = "filename=\"" + fallback.String() + "\""
+	if plain {
+		return param
+	}
+
+	return param + "; filename*=UTF-8''" + encodeRFC5987(filename)
+}
+
+// percent encodes everything but the attr-char set of RFC 5987
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		var c = s[i]
+
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0x0f])
+		}
+	}
+
+	return b.String()
 }
 
 // sets content disposition header to attachment
@@ -0,0 +1,39 @@
+package set
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brody192/ext/variables"
+)
+
+func TestAttachmentFilename(t *testing.T) {
+	var tests = []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "report.pdf", `attachment; filename="report.pdf"`},
+		{"spaces", "my report.pdf", `attachment; filename="my report.pdf"`},
+		{"quote", `say "hi".txt`, `attachment; filename="say \"hi\".txt"`},
+		{"backslash", `a\b.txt`, `attachment; filename="a\\b.txt"`},
+		{"accented", "résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+		{"cjk", "報告.txt", `attachment; filename="__.txt"; filename*=UTF-8''%E5%A0%B1%E5%91%8A.txt`},
+		{"emoji", "🎉.png", `attachment; filename="_.png"; filename*=UTF-8''%F0%9F%8E%89.png`},
+		{"non-ascii with quote", `"ü".txt`, `attachment; filename="\"_\".txt"; filename*=UTF-8''%22%C3%BC%22.txt`},
+		{"non-ascii with space and percent", "ü 100%.txt", `attachment; filename="_ 100%.txt"; filename*=UTF-8''%C3%BC%20100%25.txt`},
+		{"control characters", "a\r\nb.txt", `attachment; filename="a__b.txt"; filename*=UTF-8''a%0D%0Ab.txt`},
+		{"attr-chars kept", "ü!#$&+-.^_`|~", "attachment; filename=\"_!#$&+-.^_`|~\"; filename*=UTF-8''%C3%BC!#$&+-.^_`|~"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w = httptest.NewRecorder()
+			AttachmentFilename(w, tt.filename)
+
+			if got := w.Header().Get(variables.HeaderContentDisposition); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package utilities
+
+import "context"
+
+type requestIDKey struct{}
+
+// a request id and the header it is echoed on
+type requestID struct {
+	id     string
+	header string
+}
+
+// returns a copy of ctx carrying the given request id and the header it is echoed on
+func WithRequestID(ctx context.Context, id, header string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID{id: id, header: header})
+}
+
+// returns the request id stored on ctx, empty if there is none
+//
+// shared by middleware.RequestID, middleware.Logger and the respond package
+func GetRequestID(ctx context.Context) string {
+	if v, ok := ctx.Value(requestIDKey{}).(requestID); ok {
+		return v.id
+	}
+
+	return ""
+}
+
+// returns the header the request id stored on ctx is echoed on, empty if there is none
+func GetRequestIDHeader(ctx context.Context) string {
+	if v, ok := ctx.Value(requestIDKey{}).(requestID); ok {
+		return v.header
+	}
+
+	return ""
+}
@@ -72,3 +72,14 @@ func TrimmedPathParam(r *http.Request, p string) string {
 
 	return pp
 }
+
+// replaces leading slashes and backslashes with a single slash
+//
+// browsers treat `\\`, `//` or even `\/` at the start of a uri as an absolute uri on another host,
+// so redirecting to an unsanitized uri is an open redirect
+func SanitizeURI(uri string) string {
+	if len(uri) > 1 && (uri[0] == '\\' || uri[0] == '/') && (uri[1] == '\\' || uri[1] == '/') {
+		uri = "/" + strings.TrimLeft(uri, `/\`)
+	}
+	return uri
+}
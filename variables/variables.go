@@ -8,6 +8,9 @@ const charsetUTF8 = "charset=UTF-8"
 const (
 	MIMEApplicationJSON                  = "application/json"
 	MIMEApplicationJSONCharsetUTF8       = MIMEApplicationJSON + "; " + charsetUTF8
+	MIMEApplicationNDJSON                = "application/x-ndjson"
+	MIMEApplicationProblemJSON           = "application/problem+json"
+	MIMEApplicationProblemXML            = "application/problem+xml"
 	MIMEApplicationJavaScript            = "application/javascript"
 	MIMEApplicationJavaScriptCharsetUTF8 = MIMEApplicationJavaScript + "; " + charsetUTF8
 	MIMEApplicationXML                   = "application/xml"
@@ -17,6 +20,7 @@ const (
 	MIMEApplicationForm                  = "application/x-www-form-urlencoded"
 	MIMEApplicationProtobuf              = "application/protobuf"
 	MIMEApplicationMsgpack               = "application/msgpack"
+	MIMEApplicationCBOR                  = "application/cbor"
 	MIMETextHTML                         = "text/html"
 	MIMETextHTMLCharsetUTF8              = MIMETextHTML + "; " + charsetUTF8
 	MIMETextPlain                        = "text/plain"
@@ -92,6 +96,7 @@ const (
 	HeaderVia                             = "Via"
 	HeaderXForwardedFor                   = "X-Forwarded-For"
 	HeaderXForwardedHost                  = "X-Forwarded-Host"
+	HeaderXForwardedPort                  = "X-Forwarded-Port"
 	HeaderXForwardedProto                 = "X-Forwarded-Proto"
 	HeaderXForwardedProtocol              = "X-Forwarded-Protocol"
 	HeaderXForwardedSsl                   = "X-Forwarded-Ssl"
@@ -140,6 +145,8 @@ const (
 	HeaderAcceptSignature                 = "Accept-Signature"
 	HeaderAltSvc                          = "Alt-Svc"
 	HeaderDate                            = "Date"
+	HeaderHXBoosted                       = "HX-Boosted"
+	HeaderHXRequest                       = "HX-Request"
 	HeaderIndex                           = "Index"
 	HeaderLargeAllocation                 = "Large-Allocation"
 	HeaderLink                            = "Link"
@@ -149,12 +156,16 @@ const (
 	HeaderSignature                       = "Signature"
 	HeaderSignedHeaders                   = "Signed-Headers"
 	HeaderSourceMap                       = "SourceMap"
+	HeaderTraceparent                     = "Traceparent"
+	HeaderTracestate                      = "Tracestate"
 	HeaderUpgrade                         = "Upgrade"
+	HeaderXAccelBuffering                 = "X-Accel-Buffering"
 	HeaderXDNSPrefetchControl             = "X-DNS-Prefetch-Control"
 	HeaderXPingback                       = "X-Pingback"
 	HeaderXRequestID                      = "X-Request-ID"
 	HeaderXRequestedWith                  = "X-Requested-With"
 	HeaderXRobotsTag                      = "X-Robots-Tag"
+	HeaderXStreamError                    = "X-Stream-Error"
 	HeaderXUACompatible                   = "X-UA-Compatible"
 )
 